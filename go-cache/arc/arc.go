@@ -0,0 +1,224 @@
+package arc
+
+import (
+	"container/list"
+	"go-cache/lru"
+	"time"
+)
+
+// Value use Len to count how many bytes it takes
+type Value = lru.Value
+
+// Cache is an Adaptive Replacement Cache. It splits its budget between
+// entries seen once recently (t1) and entries seen at least twice (t2),
+// and keeps ghost lists of the keys recently evicted from each (b1, b2)
+// to adapt the split: a one-off scan only flushes t1. Sizes are counted
+// in bytes rather than entries. It is not safe for concurrent access.
+type Cache struct {
+	maxBytes int64
+	p        int64 // target size of t1 in bytes
+	t1, t2   segment
+	b1, b2   segment // ghost entries, values are dropped
+	cache    map[string]*list.Element
+	// optional and exectued when an entry is purged.
+	OnEvicted func(key string, value Value)
+}
+
+type segment struct {
+	ll     *list.List
+	nbytes int64
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time // zero means the entry never expires
+	size   int64
+	seg    *segment
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+func (e *entry) ghost(c *Cache) bool {
+	return e.seg == &c.b1 || e.seg == &c.b2
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        segment{ll: list.New()},
+		t2:        segment{ll: list.New()},
+		b1:        segment{ll: list.New()},
+		b2:        segment{ll: list.New()},
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// move moves ele to the front of seg.
+func (c *Cache) move(ele *list.Element, seg *segment) *list.Element {
+	kv := ele.Value.(*entry)
+	kv.seg.ll.Remove(ele)
+	kv.seg.nbytes -= kv.size
+	kv.seg = seg
+	seg.nbytes += kv.size
+	ele = seg.ll.PushFront(kv)
+	c.cache[kv.key] = ele
+	return ele
+}
+
+// Get looks up a key's value. Expired entries are removed and
+// reported as a miss.
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.ghost(c) {
+		return nil, false
+	}
+	if kv.expired(time.Now()) {
+		c.removeElement(ele, true)
+		return nil, false
+	}
+	// seen twice, promote to the frequent list
+	c.move(ele, &c.t2)
+	return kv.value, true
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele, !ele.Value.(*entry).ghost(c))
+	}
+}
+
+// RemoveOldest evicts the least recently used entry of t1 or t2,
+// whichever is above its target size, and remembers it as a ghost.
+func (c *Cache) RemoveOldest() {
+	if c.t1.ll.Len() > 0 && (c.t1.nbytes > c.p || c.t2.ll.Len() == 0) {
+		c.evict(c.t1.ll.Back(), &c.b1)
+	} else if c.t2.ll.Len() > 0 {
+		c.evict(c.t2.ll.Back(), &c.b2)
+	}
+}
+
+// RemoveExpired removes all entries whose expiry has passed.
+func (c *Cache) RemoveExpired() {
+	now := time.Now()
+	for _, seg := range []*segment{&c.t1, &c.t2} {
+		for ele := seg.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeElement(ele, true)
+			}
+			ele = prev
+		}
+	}
+}
+
+// evict turns a live entry into a ghost of seg.
+func (c *Cache) evict(ele *list.Element, ghost *segment) {
+	kv := ele.Value.(*entry)
+	value := kv.value
+	kv.value = nil
+	c.move(ele, ghost)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, value)
+	}
+	c.trimGhosts()
+}
+
+func (c *Cache) removeElement(ele *list.Element, live bool) {
+	kv := ele.Value.(*entry)
+	kv.seg.ll.Remove(ele)
+	kv.seg.nbytes -= kv.size
+	delete(c.cache, kv.key)
+	if live && c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// trimGhosts bounds the history to maxBytes for each of t1+b1 and t2+b2.
+func (c *Cache) trimGhosts() {
+	for c.b1.ll.Len() > 0 && c.t1.nbytes+c.b1.nbytes > c.maxBytes {
+		c.removeElement(c.b1.ll.Back(), false)
+	}
+	for c.b2.ll.Len() > 0 && c.t2.nbytes+c.b2.nbytes > c.maxBytes {
+		c.removeElement(c.b2.ll.Back(), false)
+	}
+}
+
+// Add adds a value that never expires to the cache.
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache which expires at expire.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		switch kv.seg {
+		case &c.b1:
+			// t1 was too small, grow its target
+			c.p = min(c.maxBytes, c.p+max(size, size*int64(c.b2.ll.Len()/c.b1.ll.Len())))
+		case &c.b2:
+			// t2 was too small, shrink the target of t1
+			c.p = max(0, c.p-max(size, size*int64(c.b1.ll.Len()/c.b2.ll.Len())))
+		}
+		kv.seg.nbytes += size - kv.size
+		kv.size = size
+		kv.value = value
+		kv.expire = expire
+		c.move(ele, &c.t2)
+	} else {
+		kv := &entry{key: key, value: value, expire: expire, size: size, seg: &c.t1}
+		c.t1.nbytes += size
+		c.cache[key] = c.t1.ll.PushFront(kv)
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.Bytes() {
+		c.RemoveOldest()
+	}
+	if c.maxBytes != 0 {
+		c.trimGhosts()
+	}
+}
+
+// Walk calls fn for every live entry, from the least recently used
+// entries seen once to the most recently used entries seen twice.
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	for _, seg := range []*segment{&c.t1, &c.t2} {
+		for ele := seg.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			fn(kv.key, kv.value, kv.expire)
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return c.t1.ll.Len() + c.t2.ll.Len()
+}
+
+// Bytes returns the number of bytes taken by the keys and values.
+func (c *Cache) Bytes() int64 {
+	return c.t1.nbytes + c.t2.nbytes
+}
+
+func min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
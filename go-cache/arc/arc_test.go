@@ -0,0 +1,85 @@
+package arc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.Add("key1", String("1234"))
+
+	if v, ok := arc.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1=1234 failed")
+	}
+	if _, ok := arc.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	evicted := 0
+	arc := New(int64(40), func(key string, value Value) {
+		evicted++
+	})
+	// 4 hot entries of 4 bytes, each used twice
+	for i := 0; i < 4; i++ {
+		key := fmt.Sprintf("h%d", i)
+		arc.Add(key, String("vv"))
+		arc.Get(key)
+	}
+	// a scan of one-off keys only churns t1
+	for i := 0; i < 100; i++ {
+		arc.Add(fmt.Sprintf("s%02d", i), String("v"))
+	}
+	for i := 0; i < 4; i++ {
+		if _, ok := arc.Get(fmt.Sprintf("h%d", i)); !ok {
+			t.Fatalf("hot key h%d flushed by a scan", i)
+		}
+	}
+	if arc.Bytes() > 40 || evicted == 0 {
+		t.Fatalf("expected to stay within 40 bytes but got %d", arc.Bytes())
+	}
+}
+
+func TestGhostHit(t *testing.T) {
+	arc := New(int64(8), nil)
+	arc.Add("k0", String("v0"))
+	arc.Get("k0")
+	arc.Add("k1", String("v1"))
+	arc.Add("k2", String("v2"))
+	if _, ok := arc.Get("k1"); ok {
+		t.Fatalf("k1 should be evicted")
+	}
+	// k1 is remembered as a ghost, adding it again grows t1's target
+	arc.Add("k1", String("v1"))
+	if arc.p == 0 || arc.t2.ll.Len() != 1 || arc.b2.ll.Len() != 1 {
+		t.Fatalf("ghost hit should adapt the target and promote k1")
+	}
+	if arc.Len() != 2 || arc.Bytes() != 8 {
+		t.Fatalf("expected 2 entries of 8 bytes but got %d of %d", arc.Len(), arc.Bytes())
+	}
+}
+
+func TestExpire(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.AddWithExpire("key1", String("1"), time.Now().Add(-time.Second))
+	arc.Add("key2", String("2"))
+	arc.Get("key2")
+	arc.RemoveExpired()
+
+	if _, ok := arc.Get("key1"); ok || arc.Len() != 1 {
+		t.Fatalf("RemoveExpired key1 failed")
+	}
+	arc.Remove("key2")
+	if arc.Len() != 0 || arc.Bytes() != 0 {
+		t.Fatalf("Remove key2 failed")
+	}
+}
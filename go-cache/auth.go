@@ -0,0 +1,122 @@
+package gocache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The headers carrying the HMAC signature of a request between peers.
+const (
+	timestampHeader = "X-Gocache-Timestamp" // Unix nanoseconds
+	nonceHeader     = "X-Gocache-Nonce"
+	signatureHeader = "X-Gocache-Signature"
+)
+
+var (
+	errUnsigned         = errors.New("gocache: unsigned request")
+	errInvalidSignature = errors.New("gocache: invalid signature")
+	errExpiredRequest   = errors.New("gocache: request timestamp out of range")
+	errReplayedRequest  = errors.New("gocache: replayed request")
+)
+
+// WithTLSConfig makes the pool's requests to the peers use config,
+// e.g. with the CA of the peers' certificates and, for mutual TLS, the
+// certificate of this peer. The peers' base URLs must be https ones,
+// and the pool be served by a TLS server, which verifies the client
+// certificates with tls.RequireAndVerifyClientCert for mutual TLS.
+func WithTLSConfig(config *tls.Config) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.client = &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	}
+}
+
+// WithHMAC makes the pool sign its requests to the peers with secret,
+// and reject the requests not signed with it with 401 Unauthorized.
+// A request is only accepted once, within maxSkew of its timestamp.
+// Every peer must share the same secret.
+func WithHMAC(secret []byte, maxSkew time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.signer = &signer{secret: secret, maxSkew: maxSkew, seen: make(map[string]time.Time)}
+	}
+}
+
+// signer signs the requests between peers and verifies them.
+type signer struct {
+	secret    []byte
+	maxSkew   time.Duration
+	mu        sync.Mutex           // guards seen and nextPrune
+	seen      map[string]time.Time // nonces accepted within maxSkew
+	nextPrune time.Time
+}
+
+// mac returns the signature of a request, covering its method, path,
+// timestamp, nonce and body.
+func (s *signer) mac(method, path, timestamp, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	m := hmac.New(sha256.New, s.secret)
+	for _, part := range []string{method, path, timestamp, nonce} {
+		m.Write([]byte(part))
+		m.Write([]byte{'\n'})
+	}
+	m.Write(sum[:])
+	return m.Sum(nil)
+}
+
+func (s *signer) sign(req *http.Request, body []byte) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	nonce := hex.EncodeToString(b)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(nonceHeader, nonce)
+	req.Header.Set(signatureHeader, hex.EncodeToString(
+		s.mac(req.Method, req.URL.EscapedPath(), timestamp, nonce, body)))
+	return nil
+}
+
+func (s *signer) verify(r *http.Request, body []byte) error {
+	timestamp, nonce := r.Header.Get(timestampHeader), r.Header.Get(nonceHeader)
+	signature, err := hex.DecodeString(r.Header.Get(signatureHeader))
+	if timestamp == "" || nonce == "" || len(signature) == 0 {
+		return errUnsigned
+	}
+	if err != nil || !hmac.Equal(signature, s.mac(r.Method, r.URL.EscapedPath(), timestamp, nonce, body)) {
+		return errInvalidSignature
+	}
+	ns, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errInvalidSignature
+	}
+	now := time.Now()
+	if t := time.Unix(0, ns); t.Before(now.Add(-s.maxSkew)) || t.After(now.Add(s.maxSkew)) {
+		return errExpiredRequest
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.seen[nonce]; ok {
+		return errReplayedRequest
+	}
+	// the requests of the nonces older than twice maxSkew are
+	// rejected as expired already
+	if now.After(s.nextPrune) {
+		for n, t := range s.seen {
+			if now.Sub(t) > 2*s.maxSkew {
+				delete(s.seen, n)
+			}
+		}
+		s.nextPrune = now.Add(s.maxSkew)
+	}
+	s.seen[nonce] = now
+	return nil
+}
@@ -0,0 +1,159 @@
+package gocache
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	pb "go-cache/xmcachepb"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHMAC(t *testing.T) {
+	NewGroup("hmac", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	secret := []byte("secret")
+	srv := httptest.NewServer(NewHTTPPool("peer", WithHMAC(secret, time.Minute)))
+	defer srv.Close()
+
+	get := func(p *HTTPPool) error {
+		p.Set(srv.URL)
+		return p.httpGetters[srv.URL].Get(context.Background(), &pb.Request{Group: "hmac", Key: "k"}, &pb.Response{})
+	}
+	if err := get(NewHTTPPool("self", WithHMAC(secret, time.Minute))); err != nil {
+		t.Fatalf("expected a signed request to be accepted, got %v", err)
+	}
+	for name, p := range map[string]*HTTPPool{
+		"unsigned":     NewHTTPPool("self"),
+		"wrong secret": NewHTTPPool("self", WithHMAC([]byte("wrong"), time.Minute)),
+	} {
+		if err := get(p); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Fatalf("%s: expected 401 Unauthorized, got %v", name, err)
+		}
+	}
+
+	s := &signer{secret: secret}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+defaultBasePath+"hmac/k", nil)
+	s.sign(req, nil)
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != want {
+			t.Fatalf("request %d: expected %d, got %d", i, want, res.StatusCode)
+		}
+	}
+
+	// a request signed 2 minutes ago
+	timestamp := strconv.FormatInt(time.Now().Add(-2*time.Minute).UnixNano(), 10)
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(nonceHeader, "old")
+	req.Header.Set(signatureHeader, fmt.Sprintf("%x", s.mac(req.Method, req.URL.EscapedPath(), timestamp, "old", nil)))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an expired request to be rejected, got %d", res.StatusCode)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	NewGroup("mtls", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	cert, pool := testCertificate(t)
+
+	srv := httptest.NewUnstartedServer(NewHTTPPool("peer"))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(config *tls.Config) error {
+		p := NewHTTPPool("self", WithTLSConfig(config), WithCircuitBreaker(0, 0))
+		p.Set(srv.URL)
+		return p.httpGetters[srv.URL].Get(context.Background(), &pb.Request{Group: "mtls", Key: "k"}, &pb.Response{})
+	}
+	if err := get(&tls.Config{RootCAs: pool, Certificates: []tls.Certificate{cert}}); err != nil {
+		t.Fatalf("expected the client certificate to be accepted, got %v", err)
+	}
+	if err := get(&tls.Config{RootCAs: pool}); err == nil {
+		t.Fatalf("expected a client without certificate to be rejected")
+	}
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1,
+// and a pool trusting it.
+func testCertificate(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "peer"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func TestHMACBodyLimit(t *testing.T) {
+	srv := httptest.NewServer(NewHTTPPool("peer", WithHMAC([]byte("secret"), time.Minute)))
+	defer srv.Close()
+	res, err := http.Post(srv.URL+defaultBasePath+batchPath, "application/octet-stream",
+		io.LimitReader(zeros{}, maxFrameSize+1))
+	if err != nil {
+		return // the server closed the connection before the end
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an oversized body to be rejected, got %d", res.StatusCode)
+	}
+}
+
+type zeros struct{}
+
+func (zeros) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
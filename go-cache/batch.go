@@ -0,0 +1,301 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cache/singleflight"
+	pb "go-cache/xmcachepb"
+	"log"
+	"math/rand"
+	"sync"
+)
+
+// GetMany gets the values of keys like Get, but batches the keys
+// missing from the cache: one request is sent to each peer owning
+// some of them, and the ones loaded locally go to the Getter at once
+// if it is a BatchGetter. The keys which fail to load are missing
+// from values, err is the error of the first of them.
+func (g *Group) GetMany(keys []string) (values map[string]ByteView, err error) {
+	return g.GetManyContext(context.Background(), keys)
+}
+
+// GetManyContext is like GetMany, but gives up once ctx is done.
+func (g *Group) GetManyContext(ctx context.Context, keys []string) (values map[string]ByteView, err error) {
+	values, errs := g.getMany(ctx, keys)
+	for _, key := range keys {
+		if err := errs[key]; err != nil {
+			return values, err
+		}
+	}
+	return values, nil
+}
+
+// getMany gets the values of keys, the keys failing to load are in
+// errs instead.
+func (g *Group) getMany(ctx context.Context, keys []string) (values map[string]ByteView, errs map[string]error) {
+	values = make(map[string]ByteView, len(keys))
+	errs = make(map[string]error)
+	seen := make(map[string]bool, len(keys))
+	var misses []string
+	for _, key := range keys {
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if key == "" {
+			errs[key] = fmt.Errorf("key is required")
+			continue
+		}
+		g.counters.Gets.Add(1)
+		if v, ok := g.lookupCache(key); ok {
+			g.counters.CacheHits.Add(1)
+			values[key] = v
+			continue
+		}
+		if g.lookupNegative(key) {
+			g.counters.NegativeHits.Add(1)
+			errs[key] = ErrNotFound
+			continue
+		}
+		g.counters.Loads.Add(1)
+		misses = append(misses, key)
+	}
+	if len(misses) == 0 {
+		return values, errs
+	}
+
+	// the misses share the loads in flight, of Get or other batches,
+	// and their own load is shared like Get's
+	results := g.loader.DoManyContext(ctx, misses, func(keys []string) map[string]singleflight.Result {
+		g.counters.LoadsDeduped.Add(int64(len(keys)))
+		ctx := context.Context(detachedContext{ctx})
+		if g.loadTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, g.loadTimeout)
+			defer cancel()
+		}
+		loaded, failed := g.loadMany(ctx, keys)
+		results := make(map[string]singleflight.Result, len(keys))
+		for key, value := range loaded {
+			results[key] = singleflight.Result{Val: value}
+		}
+		for key, err := range failed {
+			results[key] = singleflight.Result{Err: err}
+		}
+		return results
+	})
+	for key, res := range results {
+		if res.Err != nil {
+			errs[key] = res.Err
+			continue
+		}
+		values[key] = res.Val.(ByteView)
+	}
+	return values, errs
+}
+
+// loadMany loads the keys missing from the cache, from their owners
+// and then locally.
+func (g *Group) loadMany(ctx context.Context, misses []string) (values map[string]ByteView, errs map[string]error) {
+	values = make(map[string]ByteView, len(misses))
+	errs = make(map[string]error)
+
+	// the remaining owners of each key, tried in order
+	owners := make(map[string][]PeerGetter)
+	var pending, local []string
+	for _, key := range misses {
+		if g.peers == nil {
+			local = append(local, key)
+			continue
+		}
+		if peers, primary := g.peers.PickPeer(key); primary || len(peers) == 0 {
+			local = append(local, key)
+		} else {
+			owners[key] = peers
+			pending = append(pending, key)
+		}
+	}
+
+	var mu sync.Mutex // guards values, errs and pending
+	for len(pending) > 0 {
+		batches := make(map[PeerGetter][]string)
+		for _, key := range pending {
+			if len(owners[key]) == 0 {
+				local = append(local, key)
+				continue
+			}
+			peer := owners[key][0]
+			owners[key] = owners[key][1:]
+			batches[peer] = append(batches[peer], key)
+		}
+		pending = nil
+
+		var wg sync.WaitGroup
+		for peer, batch := range batches {
+			wg.Add(1)
+			go func(peer PeerGetter, batch []string) {
+				defer wg.Done()
+				found, notFound, err := g.getManyFromPeer(ctx, peer, batch)
+				if err != nil {
+					g.counters.PeerErrors.Add(1)
+					log.Println("[XmCache] Failed to get from peer", err)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				for _, key := range batch {
+					if notFound[key] {
+						g.populateNegative(key)
+						errs[key] = ErrNotFound
+						continue
+					}
+					value, ok := found[key]
+					if !ok {
+						pending = append(pending, key)
+						continue
+					}
+					g.counters.PeerLoads.Add(1)
+					if rand.Intn(hotCacheSampling) == 0 {
+						g.popluateCache(key, value, g.hotCache)
+					}
+					values[key] = value
+				}
+			}(peer, batch)
+		}
+		wg.Wait()
+	}
+
+	if len(local) > 0 {
+		g.getManyLocally(ctx, local, values, errs)
+	}
+	return values, errs
+}
+
+// getManyFromPeer gets keys from peer, in a single request if it is a
+// BatchPeerGetter. The keys the peer failed to get are missing from
+// values, the ones which don't exist are in notFound.
+func (g *Group) getManyFromPeer(ctx context.Context, peer PeerGetter, keys []string) (values map[string]ByteView, notFound map[string]bool, err error) {
+	values = make(map[string]ByteView, len(keys))
+	notFound = make(map[string]bool)
+	bp, ok := peer.(BatchPeerGetter)
+	if !ok {
+		for _, key := range keys {
+			value, e := g.getFromPeer(ctx, peer, key)
+			switch {
+			case errors.Is(e, ErrNotFound):
+				notFound[key] = true
+			case e != nil:
+				err = e
+			default:
+				values[key] = value
+			}
+		}
+		return values, notFound, err
+	}
+
+	req := &pb.BatchRequest{Group: g.name, Keys: keys}
+	res := &pb.BatchResponse{}
+	if err := bp.GetMany(ctx, req, res); err != nil {
+		return nil, nil, err
+	}
+	if len(res.Values) != len(keys) {
+		return nil, nil, fmt.Errorf("peer returned %d values for %d keys", len(res.Values), len(keys))
+	}
+	for i, v := range res.Values {
+		switch {
+		case v.NotFound:
+			notFound[keys[i]] = true
+		case v.Error == "":
+			values[keys[i]] = responseView(v)
+		}
+	}
+	return values, notFound, nil
+}
+
+// getManyLocally loads keys with the group's Getter, with a single
+// call if it is a BatchGetter.
+func (g *Group) getManyLocally(ctx context.Context, keys []string, values map[string]ByteView, errs map[string]error) {
+	bg, ok := g.getter.(BatchGetter)
+	if !ok {
+		for _, key := range keys {
+			value, err := g.getLocally(ctx, key)
+			if err != nil {
+				g.counters.LocalLoadErrs.Add(1)
+				errs[key] = err
+				continue
+			}
+			g.counters.LocalLoads.Add(1)
+			values[key] = value
+		}
+		return
+	}
+
+	// the writes pending in WithWriteBehind are newer than the data
+	// source
+	loads := keys[:0:0]
+	for _, key := range keys {
+		value, ok, err := g.pendingValue(key)
+		switch {
+		case !ok:
+			loads = append(loads, key)
+		case err != nil:
+			g.counters.LocalLoadErrs.Add(1)
+			errs[key] = err
+		default:
+			g.counters.LocalLoads.Add(1)
+			g.popluateCache(key, value, g.mainCache)
+			values[key] = value
+		}
+	}
+	if len(loads) == 0 {
+		return
+	}
+	keys = loads
+
+	var (
+		found map[string]Result
+		err   error
+	)
+	if rg, ok := bg.(BatchResultGetter); ok {
+		found, err = rg.GetManyResults(ctx, keys)
+	} else {
+		var bytes map[string][]byte
+		bytes, err = bg.GetMany(keys)
+		found = make(map[string]Result, len(bytes))
+		for key, b := range bytes {
+			found[key] = Result{Value: b}
+		}
+	}
+	for _, key := range keys {
+		res, ok := found[key]
+		if err != nil || !ok {
+			g.counters.LocalLoadErrs.Add(1)
+			errs[key] = err
+			if err == nil {
+				g.populateNegative(key)
+				errs[key] = ErrNotFound
+			}
+			continue
+		}
+		g.counters.LocalLoads.Add(1)
+		value := g.resultView(res)
+		g.popluateCache(key, value, g.mainCache)
+		values[key] = value
+	}
+}
+
+// batchResponse returns the BatchResponse a peer sends for keys.
+func batchResponse(keys []string, values map[string]ByteView, errs map[string]error) *pb.BatchResponse {
+	res := &pb.BatchResponse{Values: make([]*pb.Response, len(keys))}
+	for i, key := range keys {
+		if value, ok := values[key]; ok {
+			res.Values[i] = viewResponse(value)
+			continue
+		}
+		res.Values[i] = errResponse(errs[key])
+		if res.Values[i] == nil {
+			res.Values[i] = &pb.Response{Error: errs[key].Error()}
+		}
+	}
+	return res
+}
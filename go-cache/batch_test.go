@@ -0,0 +1,122 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	pb "go-cache/xmcachepb"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGetMany(t *testing.T) {
+	var batches [][]string
+	xm := NewGroup("batch", 2<<10, BatchGetterFunc(
+		func(keys []string) (map[string][]byte, error) {
+			batches = append(batches, keys)
+			values := make(map[string][]byte)
+			for _, key := range keys {
+				if v, ok := db[key]; ok {
+					values[key] = []byte(v)
+				}
+			}
+			return values, nil
+		}))
+	owner := &fakePeer{values: map[string][]byte{"remote1": []byte("1"), "remote2": []byte("2")}}
+	xm.RegisterPeers(fakePeers{owner})
+
+	keys := []string{"Tom", "remote1", "Jack", "unknown", "remote2", "Tom"}
+	values, err := xm.GetMany(keys)
+	if err == nil {
+		t.Fatalf("expected unknown to fail")
+	}
+	want := map[string]string{"Tom": "630", "Jack": "589", "remote1": "1", "remote2": "2"}
+	if len(values) != len(want) {
+		t.Fatalf("expected %d values, got %v", len(want), values)
+	}
+	for k, v := range want {
+		if values[k].String() != v {
+			t.Fatalf("expected %s=%s, got %v", k, v, values[k])
+		}
+	}
+	if !reflect.DeepEqual(batches, [][]string{{"Tom", "Jack", "unknown"}}) {
+		t.Fatalf("expected a single batch of the local misses, got %v", batches)
+	}
+
+	if _, err := xm.GetMany([]string{"Tom", "Jack"}); err != nil || len(batches) != 1 {
+		t.Fatalf("expected the cached keys to be served without loading")
+	}
+}
+
+func TestHTTPPoolGetMany(t *testing.T) {
+	NewGroup("http-batch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	res := &pb.BatchResponse{}
+	in := &pb.BatchRequest{Group: "http-batch", Keys: []string{"Tom", "unknown", "Sam"}}
+	if err := getter.GetMany(context.Background(), in, res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Values) != 3 || string(res.Values[0].Value) != "630" || string(res.Values[2].Value) != "567" {
+		t.Fatalf("unexpected batch response %v", res)
+	}
+	if res.Values[1].Error != "unknown not exist" {
+		t.Fatalf("expected the loader error for unknown, got %q", res.Values[1].Error)
+	}
+
+	in.Group = "no-such-group"
+	if err := getter.GetMany(context.Background(), in, res); err == nil {
+		t.Fatalf("expected an unknown group error")
+	}
+}
+
+func TestGetManySharesLoads(t *testing.T) {
+	var mu sync.Mutex
+	loads := make(map[string]int)
+	started, release := make(chan bool, 1), make(chan bool)
+	xm := NewGroup("batch-shared", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			mu.Lock()
+			loads[key]++
+			mu.Unlock()
+			if key == "k" {
+				started <- true
+				<-release
+			}
+			return []byte(key), nil
+		}))
+
+	done := make(chan error)
+	go func() {
+		_, err := xm.Get("k")
+		done <- err
+	}()
+	<-started
+	go func() {
+		_, err := xm.GetMany([]string{"k", "j"})
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if loads["k"] != 1 || loads["j"] != 1 {
+		t.Fatalf("expected each key to be loaded once, got %v", loads)
+	}
+	if s := xm.Stats(); s.Loads != 3 || s.LoadsDeduped != 2 || s.LoadsShared != 1 {
+		t.Fatalf("expected 3 loads deduped to 2 with 1 shared, got %d, %d and %d", s.Loads, s.LoadsDeduped, s.LoadsShared)
+	}
+}
@@ -1,8 +1,12 @@
 package gocache
 
+import "time"
+
 // ByteView holds an immutable view of bytes.
 type ByteView struct {
-	b []byte
+	b    []byte
+	e    time.Time
+	tags []string // attached by a ResultGetter
 }
 
 // Len returns the view's length
@@ -10,6 +14,18 @@ func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+// Expire returns the time the view expires at, the zero time means
+// it never expires.
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
+// Tags returns the tags the Getter attached to the view, they must not
+// be modified.
+func (v ByteView) Tags() []string {
+	return v.tags
+}
+
 // ByteSlice returns a copy of the data as a byte slice.
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
@@ -3,33 +3,280 @@ package gocache
 import (
 	"go-cache/lru"
 	"sync"
+	"time"
 )
 
+// purgeInterval is how often expired entries are swept out of the
+// caches of every group, in addition to being dropped lazily on
+// access.
+const purgeInterval = time.Minute
+
+var purgeOnce sync.Once
+
+// purgeLoop purges the caches of every group each purgeInterval, so
+// that the entries expiring in caches no longer used are dropped too.
+func purgeLoop() {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		mu.RLock()
+		all := make([]*Group, 0, len(groups))
+		for _, g := range groups {
+			all = append(all, g)
+		}
+		mu.RUnlock()
+		for _, g := range all {
+			g.mainCache.purge()
+			g.hotCache.purge()
+			g.negCache.purge()
+		}
+	}
+}
+
+// cache is a concurrency safe cache made of hash partitioned shards,
+// each guarded by its own lock and holding a share of the budget.
+// The owning Group also bounds the sum of its caches.
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
-	cacheBytes int64
+	shards []*shard
+	// grace keeps the entries for this long after they expire, so
+	// that they can be served stale.
+	grace time.Duration
+}
+
+// shard is a concurrency safe wrapper of a Policy which keeps
+// statistics.
+type shard struct {
+	mu     sync.Mutex
+	policy Policy
+	nhit   int64
+	nget   int64
+	nevict int64 // number of evictions to make room
+	// dropping is set while entries are removed on purpose, such as
+	// expired ones, which are not counted as evictions
+	dropping bool
+	// usage is kept up to date with the changes of the shard's
+	// bytes when set
+	usage *AtomicInt
+}
+
+// CacheStats are returned by stats accessors on Group.
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`
+	Items     int64 `json:"items"`
+	Gets      int64 `json:"gets"`
+	Hits      int64 `json:"hits"`
+	Evictions int64 `json:"evictions"` // to make room, not removals or expiry
+}
+
+func newCache(shards int, maxBytes int64, newPolicy PolicyFunc) *cache {
+	if shards < 1 {
+		shards = 1
+	}
+	if newPolicy == nil {
+		newPolicy = LRU
+	}
+	c := &cache{shards: make([]*shard, shards)}
+	for i := range c.shards {
+		s := &shard{}
+		s.policy = newPolicy(maxBytes/int64(shards), func(key string, value lru.Value) {
+			if !s.dropping {
+				s.nevict++
+			}
+		})
+		c.shards[i] = s
+	}
+	return c
+}
+
+// trackUsage makes the cache add the changes of its bytes to usage, so
+// that they are known without locking the shards.
+func (c *cache) trackUsage(usage *AtomicInt) {
+	for _, s := range c.shards {
+		s.usage = usage
+	}
+}
+
+// shard returns the shard of key, picked by its FNV-1a hash.
+func (c *cache) shard(key string) *shard {
+	if len(c.shards) == 1 {
+		return c.shards[0]
+	}
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return c.shards[h%uint32(len(c.shards))]
+}
+
+func (c *cache) stats() (stats CacheStats) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		stats.Bytes += s.policy.Bytes()
+		stats.Items += int64(s.policy.Len())
+		stats.Gets += s.nget
+		stats.Hits += s.nhit
+		stats.Evictions += s.nevict
+		s.mu.Unlock()
+	}
+	return
 }
 
 func (c *cache) add(key string, value ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	expire := value.Expire()
+	if !expire.IsZero() {
+		expire = expire.Add(c.grace)
 	}
-	c.lru.Add(key, value)
+	c.shard(key).add(key, value, expire)
 }
 
 func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
-		return
+	return c.shard(key).get(key)
+}
+
+func (c *cache) remove(key string) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.track(s.policy.Bytes())
+	s.drop(func() {
+		s.policy.Remove(key)
+	})
+}
+
+// removeIf removes key if its value is the one fn reports, checking it
+// under the shard's lock so that a value written meanwhile stays.
+func (c *cache) removeIf(key string, fn func(value ByteView) bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.track(s.policy.Bytes())
+	s.drop(func() {
+		if v, ok := s.policy.Get(key); ok && fn(v.(ByteView)) {
+			s.policy.Remove(key)
+		}
+	})
+}
+
+// removeOldest evicts an entry from the largest shard, and reports
+// whether the cache held any.
+func (c *cache) removeOldest() bool {
+	var victim *shard
+	var max int64
+	for _, s := range c.shards {
+		if b := s.bytes(); victim == nil || b > max {
+			victim, max = s, b
+		}
 	}
+	if max == 0 {
+		return false
+	}
+	victim.mu.Lock()
+	defer victim.mu.Unlock()
+	defer victim.track(victim.policy.Bytes())
+	victim.policy.RemoveOldest()
+	return true
+}
 
-	if v, ok := c.lru.Get(key); ok {
-		return v.(ByteView), ok
+// walk calls fn for every entry of every shard, in the order of the
+// shard's Policy.Walk. The shards are locked one at a time, so fn
+// must not use the cache.
+func (c *cache) walk(fn func(key string, value ByteView)) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		s.policy.Walk(func(key string, value lru.Value, expire time.Time) {
+			fn(key, value.(ByteView))
+		})
+		s.mu.Unlock()
 	}
+}
 
+// removeFunc removes the entries for which fn returns true.
+func (c *cache) removeFunc(fn func(key string, value ByteView) bool) {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		var keys []string
+		s.policy.Walk(func(key string, value lru.Value, expire time.Time) {
+			if fn(key, value.(ByteView)) {
+				keys = append(keys, key)
+			}
+		})
+		before := s.policy.Bytes()
+		s.drop(func() {
+			for _, key := range keys {
+				s.policy.Remove(key)
+			}
+		})
+		s.track(before)
+		s.mu.Unlock()
+	}
+}
+
+// purge drops the expired entries, one shard at a time so that only
+// the lookups of the shard being purged wait.
+func (c *cache) purge() {
+	for _, s := range c.shards {
+		s.mu.Lock()
+		before := s.policy.Bytes()
+		s.drop(s.policy.RemoveExpired)
+		s.track(before)
+		s.mu.Unlock()
+	}
+}
+
+func (c *cache) bytes() (n int64) {
+	for _, s := range c.shards {
+		n += s.bytes()
+	}
 	return
 }
+
+func (s *shard) add(key string, value ByteView, expire time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.track(s.policy.Bytes())
+	s.policy.AddWithExpire(key, value, expire)
+}
+
+func (s *shard) get(key string) (value ByteView, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a lookup drops the expired entries
+	defer s.track(s.policy.Bytes())
+	s.nget++
+	// like drop, without a closure on the lookups
+	s.dropping = true
+	v, ok := s.policy.Get(key)
+	s.dropping = false
+	if ok {
+		s.nhit++
+		return v.(ByteView), ok
+	}
+	return
+}
+
+// drop runs fn, which removes entries on purpose rather than to make
+// room for others. It is called with the shard locked.
+func (s *shard) drop(fn func()) {
+	s.dropping = true
+	defer func() { s.dropping = false }()
+	fn()
+}
+
+// track adds the change of the shard's bytes since before to its usage,
+// it is called with the shard locked. The hits leave the bytes alone
+// and don't touch the usage shared by the shards.
+func (s *shard) track(before int64) {
+	if s.usage == nil {
+		return
+	}
+	if delta := s.policy.Bytes() - before; delta != 0 {
+		s.usage.Add(delta)
+	}
+}
+
+func (s *shard) bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.policy.Bytes()
+}
@@ -0,0 +1,115 @@
+package gocache
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestShards(t *testing.T) {
+	c := newCache(4, 4<<10, nil)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, ByteView{b: []byte(key)})
+	}
+	for i, s := range c.shards {
+		if s.policy.Len() == 0 || s.policy.Bytes() > 1<<10 {
+			t.Fatalf("shard %d holds %d bytes in %d entries", i, s.policy.Bytes(), s.policy.Len())
+		}
+	}
+	if v, ok := c.get("999"); !ok || v.String() != "999" {
+		t.Fatalf("cache hit 999 failed")
+	}
+	if stats := c.stats(); stats.Bytes > 4<<10 || stats.Evictions == 0 || stats.Hits != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestTrackUsage(t *testing.T) {
+	var usage AtomicInt
+	c := newCache(4, 1<<10, nil)
+	c.trackUsage(&usage)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		c.add(key, ByteView{b: []byte(key)})
+	}
+	if usage.Get() != c.bytes() {
+		t.Fatalf("expected usage %d after evictions, got %d", c.bytes(), usage.Get())
+	}
+	c.remove("999")
+	c.removeOldest()
+	c.removeFunc(func(key string, value ByteView) bool {
+		return len(key) == 2
+	})
+	if usage.Get() != c.bytes() {
+		t.Fatalf("expected usage %d after removals, got %d", c.bytes(), usage.Get())
+	}
+}
+
+func TestEvictions(t *testing.T) {
+	c := newCache(1, 0, nil)
+	c.add("a", ByteView{b: []byte("1")})
+	c.add("b", ByteView{b: []byte("1"), e: time.Now().Add(-time.Second)})
+	c.add("c", ByteView{b: []byte("1")})
+	c.remove("a")
+	c.get("b")
+	c.removeFunc(func(key string, value ByteView) bool { return true })
+	if n := c.stats().Evictions; n != 0 {
+		t.Fatalf("expected the removals not to count as evictions, got %d", n)
+	}
+	c.add("a", ByteView{b: []byte("1")})
+	c.removeOldest()
+	if n := c.stats().Evictions; n != 1 {
+		t.Fatalf("expected 1 eviction, got %d", n)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	var usage AtomicInt
+	c := newCache(4, 0, nil)
+	c.trackUsage(&usage)
+	for i := 0; i < 100; i++ {
+		expire := time.Now().Add(time.Hour)
+		if i%2 == 0 {
+			expire = time.Now().Add(-time.Second)
+		}
+		c.add(strconv.Itoa(i), ByteView{b: []byte("v"), e: expire})
+	}
+	c.purge()
+	if stats := c.stats(); stats.Items != 50 || stats.Evictions != 0 || usage.Get() != stats.Bytes {
+		t.Fatalf("expected the expired entries to be purged, got %+v and usage %d", stats, usage.Get())
+	}
+}
+
+// benchmarkGroupGet runs parallel Group.Get calls hitting the main
+// cache of a group split into the given number of shards.
+func benchmarkGroupGet(b *testing.B, shards int) {
+	const keys = 1024
+	g := NewGroup(fmt.Sprintf("bench-%d", shards), 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithShards(shards))
+	for i := 0; i < keys; i++ {
+		g.Get(strconv.Itoa(i))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := g.Get(strconv.Itoa(i % keys)); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkGroupGet(b *testing.B) {
+	for _, shards := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			benchmarkGroupGet(b, shards)
+		})
+	}
+}
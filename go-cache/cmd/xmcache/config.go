@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config is the configuration of a node, read from a JSON file and
+// overridden by the flags.
+type config struct {
+	// this peer's base URL, e.g. "http://10.0.0.1:8001"
+	Self string `json:"self"`
+	// address the peers' requests are served on, e.g. ":8001"
+	Listen   string   `json:"listen"`
+	BasePath string   `json:"base_path"`
+	Peers    []string `json:"peers"`
+	// optional interval of the health probes of the peers
+	HealthInterval duration `json:"health_interval"`
+	// optional address the API is served on, e.g. ":9999"
+	API    string        `json:"api"`
+	Groups []groupConfig `json:"groups"`
+	// optional memory shared by the groups, their cache_bytes are
+	// then ignored
+	MemoryBytes int64 `json:"memory_bytes"`
+	// optional TLS of the traffic between peers
+	TLS *tlsConfig `json:"tls"`
+	// optional file holding the secret the peers sign their requests
+	// with, and the maximum age of a signed request
+	HMACSecretFile string   `json:"hmac_secret_file"`
+	HMACMaxSkew    duration `json:"hmac_max_skew"`
+}
+
+// tlsConfig configures the TLS of the traffic between peers, Self and
+// Peers must then be https URLs.
+type tlsConfig struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+	// optional CA of the peers' certificates, the system's by default
+	CA string `json:"ca"`
+	// whether the peers must present a certificate signed by CA
+	Mutual bool `json:"mutual"`
+}
+
+// groupConfig configures a group loading its values from an origin.
+type groupConfig struct {
+	Name       string `json:"name"`
+	CacheBytes int64  `json:"cache_bytes"`
+	// URL template of the values, "{key}" is replaced by the key.
+	Origin string   `json:"origin"`
+	TTL    duration `json:"ttl"`
+	// bound of a load from the origin, defaultLoadTimeout when zero
+	LoadTimeout duration `json:"load_timeout"`
+	// optional file the group is restored from and saved to
+	Snapshot string `json:"snapshot"`
+	// share of memory_bytes, see gocache.Share
+	Weight   int   `json:"weight"`
+	MinBytes int64 `json:"min_bytes"`
+	MaxBytes int64 `json:"max_bytes"`
+}
+
+// defaultLoadTimeout bounds the loads from an origin, so that a hung
+// origin doesn't block the callers of a key forever.
+const defaultLoadTimeout = 10 * time.Second
+
+// duration is a time.Duration written as a string in JSON, e.g. "5m".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = duration(v)
+	return err
+}
+
+// groupFlags collects the groups given as name:bytes:origin.
+type groupFlags []groupConfig
+
+func (g *groupFlags) String() string {
+	return fmt.Sprint(*g)
+}
+
+func (g *groupFlags) Set(s string) error {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return errors.New("expected name:bytes:origin")
+	}
+	n, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	*g = append(*g, groupConfig{Name: parts[0], CacheBytes: n, Origin: parts[2]})
+	return nil
+}
+
+// loadConfig returns the configuration given by args, the flags take
+// precedence over the config file.
+func loadConfig(args []string) (*config, error) {
+	fs := flag.NewFlagSet("xmcache", flag.ContinueOnError)
+	path := fs.String("config", "", "JSON config file")
+	self := fs.String("self", "", "this peer's base URL, e.g. http://10.0.0.1:8001")
+	listen := fs.String("listen", "", "address to serve the peers on, e.g. :8001")
+	basePath := fs.String("base-path", "", "path prefix of the requests between peers")
+	peers := fs.String("peers", "", "comma separated base URLs of all the peers")
+	api := fs.String("api", "", "address to serve the API on, e.g. :9999")
+	var groups groupFlags
+	fs.Var(&groups, "group", "group as name:bytes:origin, may be repeated")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := &config{BasePath: "/_geecache/", HMACMaxSkew: duration(time.Minute)}
+	if *path != "" {
+		f, err := os.Open(*path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("%s: %v", *path, err)
+		}
+	}
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "self":
+			cfg.Self = *self
+		case "listen":
+			cfg.Listen = *listen
+		case "base-path":
+			cfg.BasePath = *basePath
+		case "peers":
+			cfg.Peers = strings.Split(*peers, ",")
+		case "api":
+			cfg.API = *api
+		case "group":
+			cfg.Groups = append(cfg.Groups, groups...)
+		}
+	})
+	for i := range cfg.Groups {
+		if cfg.Groups[i].LoadTimeout == 0 {
+			cfg.Groups[i].LoadTimeout = duration(defaultLoadTimeout)
+		}
+	}
+	return cfg, cfg.validate()
+}
+
+func (cfg *config) validate() error {
+	switch {
+	case cfg.Self == "":
+		return errors.New("self is required")
+	case cfg.Listen == "":
+		return errors.New("listen is required")
+	case !strings.HasPrefix(cfg.BasePath, "/") || !strings.HasSuffix(cfg.BasePath, "/"):
+		return fmt.Errorf("base path %q must start and end with a slash", cfg.BasePath)
+	case len(cfg.Groups) == 0:
+		return errors.New("at least one group is required")
+	}
+	if t := cfg.TLS; t != nil && (t.Cert == "" || t.Key == "" || t.Mutual && t.CA == "") {
+		return errors.New("tls needs a cert, a key, and a ca when mutual")
+	}
+	for _, g := range cfg.Groups {
+		if g.Name == "" || g.Origin == "" {
+			return fmt.Errorf("group %q needs a name and an origin", g.Name)
+		}
+	}
+	return nil
+}
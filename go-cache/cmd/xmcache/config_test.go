@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xmcache.json")
+	err := os.WriteFile(path, []byte(`{
+		"self": "http://localhost:8001",
+		"listen": ":8001",
+		"peers": ["http://localhost:8001", "http://localhost:8002"],
+		"groups": [{"name": "scores", "cache_bytes": 1024, "origin": "http://origin/{key}", "ttl": "5m", "load_timeout": "2s"}]
+	}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfig([]string{"-config", path, "-listen", ":9001", "-group", "users:2048:http://origin/users/{key}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Self != "http://localhost:8001" || cfg.Listen != ":9001" || cfg.BasePath != "/_geecache/" {
+		t.Fatalf("expected the flags to override the file, got %+v", cfg)
+	}
+	want := []groupConfig{
+		{Name: "scores", CacheBytes: 1024, Origin: "http://origin/{key}", TTL: duration(5 * time.Minute), LoadTimeout: duration(2 * time.Second)},
+		{Name: "users", CacheBytes: 2048, Origin: "http://origin/users/{key}", LoadTimeout: duration(defaultLoadTimeout)},
+	}
+	if !reflect.DeepEqual(cfg.Groups, want) {
+		t.Fatalf("expected groups %+v, got %+v", want, cfg.Groups)
+	}
+
+	if _, err := loadConfig([]string{"-self", "http://localhost:8001", "-listen", ":8001"}); err == nil {
+		t.Fatalf("expected a config without groups to be rejected")
+	}
+	if _, err := loadConfig([]string{"-config", path, "-base-path", "/cache"}); err == nil {
+		t.Fatalf("expected a base path without a trailing slash to be rejected")
+	}
+}
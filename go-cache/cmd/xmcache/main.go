@@ -0,0 +1,179 @@
+// Command xmcache runs a cache node loading its values from HTTP
+// origins, e.g.
+//
+//	xmcache -config xmcache.json
+//	xmcache -self http://10.0.0.1:8001 -listen :8001 \
+//		-peers http://10.0.0.1:8001,http://10.0.0.2:8001 \
+//		-group 'scores:1048576:http://origin/scores/{key}'
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	gocache "go-cache"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout bounds how long the requests in flight may take to
+// complete on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+func main() {
+	cfg, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	poolOpts, serverTLS, err := securityOptions(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	poolOpts = append(poolOpts, gocache.WithBasePath(cfg.BasePath),
+		gocache.WithHealthCheck(time.Duration(cfg.HealthInterval)))
+	pool := gocache.NewHTTPPool(cfg.Self, poolOpts...)
+	defer pool.Close()
+	pool.Set(cfg.Peers...)
+	var memory *gocache.MemoryManager
+	if cfg.MemoryBytes > 0 {
+		memory = gocache.NewMemoryManager(cfg.MemoryBytes)
+	}
+	var groups []*gocache.Group
+	for _, gc := range cfg.Groups {
+		opts := []gocache.GroupOption{
+			gocache.WithTTL(time.Duration(gc.TTL)),
+			gocache.WithLoadTimeout(time.Duration(gc.LoadTimeout)),
+		}
+		if memory != nil {
+			opts = append(opts, gocache.WithMemoryManager(memory, gocache.Share{
+				Weight:   gc.Weight,
+				MinBytes: gc.MinBytes,
+				MaxBytes: gc.MaxBytes,
+			}))
+		}
+		if gc.Snapshot != "" {
+			opts = append(opts, gocache.WithSnapshotFile(gc.Snapshot))
+		}
+		g := gocache.NewGroup(gc.Name, gc.CacheBytes, &gocache.OriginGetter{URL: gc.Origin}, opts...)
+		g.RegisterPeers(pool)
+		groups = append(groups, g)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.BasePath, pool)
+	mux.Handle("/metrics", gocache.MetricsHandler(pool))
+	servers := []*http.Server{{Addr: cfg.Listen, Handler: mux, TLSConfig: serverTLS}}
+	if cfg.API != "" {
+		servers = append(servers, &http.Server{Addr: cfg.API, Handler: http.HandlerFunc(serveAPI)})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func(srv *http.Server) {
+			log.Println("xmcache is running at", srv.Addr)
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				errc <- err
+			}
+		}(srv)
+	}
+	select {
+	case <-ctx.Done():
+		log.Println("xmcache is shutting down")
+	case err := <-errc:
+		log.Println(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println("shutdown:", err)
+		}
+	}
+	for _, g := range groups {
+		if err := g.Close(); err != nil {
+			log.Println("closing group:", err)
+		}
+	}
+}
+
+// securityOptions returns the pool options securing the traffic
+// between peers, and the TLS config of the server of the peers, nil
+// without TLS.
+func securityOptions(cfg *config) ([]gocache.HTTPPoolOption, *tls.Config, error) {
+	var opts []gocache.HTTPPoolOption
+	if cfg.HMACSecretFile != "" {
+		secret, err := os.ReadFile(cfg.HMACSecretFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		secret = bytes.TrimSpace(secret)
+		if len(secret) == 0 {
+			return nil, nil, fmt.Errorf("%s: empty secret", cfg.HMACSecretFile)
+		}
+		opts = append(opts, gocache.WithHMAC(secret, time.Duration(cfg.HMACMaxSkew)))
+	}
+	if cfg.TLS == nil {
+		return opts, nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLS.Cert, cfg.TLS.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	server := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	client := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLS.CA != "" {
+		pem, err := os.ReadFile(cfg.TLS.CA)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("%s: no certificate found", cfg.TLS.CA)
+		}
+		client.RootCAs = pool
+		if cfg.TLS.Mutual {
+			server.ClientCAs = pool
+			server.ClientAuth = tls.RequireAndVerifyClientCert
+			client.Certificates = []tls.Certificate{cert}
+		}
+	}
+	return append(opts, gocache.WithTLSConfig(client)), server, nil
+}
+
+// serveAPI answers GET /?group=<group>&key=<key> with the value.
+func serveAPI(w http.ResponseWriter, r *http.Request) {
+	g := gocache.GetGroup(r.URL.Query().Get("group"))
+	if g == nil {
+		http.Error(w, "no such group", http.StatusNotFound)
+		return
+	}
+	view, err := g.GetContext(r.Context(), r.URL.Query().Get("key"))
+	if errors.Is(err, gocache.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(view.ByteSlice())
+}
@@ -2,6 +2,7 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
 )
@@ -9,12 +10,20 @@ import (
 // Hash maps bytes to uint32
 type Hash func(data []byte) uint32
 
-// Map contains all hashed keys
+// Map contains all hashed keys. Get and GetN may be called
+// concurrently, the other methods may not.
 type Map struct {
 	hash     Hash
 	replicas int
 	keys     []int // Sorted
 	hashMap  map[int]string
+	weights  map[string]int // weight of each node
+	total    int            // sum of the weights
+
+	// bounded loads, disabled when epsilon is zero
+	epsilon float64
+	loads   map[string]int64
+	load    int64 // sum of the loads
 }
 
 func New(replicas int, fn Hash) *Map {
@@ -22,6 +31,8 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
+		loads:    make(map[string]int64),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -29,19 +40,86 @@ func New(replicas int, fn Hash) *Map {
 	return m
 }
 
-// Add adds some keys to the hash.
+// NewBounded creates a Map implementing consistent hashing with
+// bounded loads: Get skips the nodes whose load would exceed
+// (1+epsilon) times their fair share, the load being tracked with
+// Inc and Done.
+func NewBounded(replicas int, epsilon float64, fn Hash) *Map {
+	m := New(replicas, fn)
+	m.epsilon = epsilon
+	return m
+}
+
+// Add adds some keys to the hash with a weight of 1. The keys already
+// in the hash keep their weight.
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		if _, ok := m.weights[key]; !ok {
+			m.add(key, 1)
 		}
 	}
 	sort.Ints(m.keys)
 }
 
-// Get gets the cloest item in the hash to the provided key
+// AddWeighted adds a key with weight times more replicas than the
+// keys added by Add, so it owns a proportional share of the hash. The
+// weight of a key already in the hash is replaced.
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.add(key, weight)
+	sort.Ints(m.keys)
+}
+
+func (m *Map) add(key string, weight int) {
+	if _, ok := m.weights[key]; ok {
+		m.remove(key)
+	}
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		m.keys = append(m.keys, hash)
+		m.hashMap[hash] = key
+	}
+	m.weights[key] = weight
+	m.total += weight
+}
+
+// Remove removes some keys and only their own replicas from the hash,
+// so only the keys they owned move to other nodes.
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		m.remove(key)
+	}
+}
+
+func (m *Map) remove(key string) {
+	weight, ok := m.weights[key]
+	if !ok {
+		return
+	}
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		if m.hashMap[hash] == key {
+			delete(m.hashMap, hash)
+		}
+	}
+	kept := m.keys[:0]
+	for _, hash := range m.keys {
+		if _, ok := m.hashMap[hash]; ok {
+			kept = append(kept, hash)
+		}
+	}
+	m.keys = kept
+	delete(m.weights, key)
+	m.total -= weight
+	m.load -= m.loads[key]
+	delete(m.loads, key)
+}
+
+// Get gets the cloest item in the hash to the provided key. With
+// bounded loads, the next items on the ring are used while the
+// closest one is full.
 func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
 		return ""
@@ -52,5 +130,98 @@ func (m *Map) Get(key string) string {
 	idx := sort.Search(len(m.keys), func(i int) bool {
 		return m.keys[i] >= hash
 	})
+	if m.epsilon == 0 {
+		return m.hashMap[m.keys[idx%len(m.keys)]]
+	}
+	for i := 0; i < len(m.keys); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if m.loads[node]+1 <= m.MaxLoad(node) {
+			return node
+		}
+	}
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+// GetN gets up to n distinct items following the provided key on the
+// hash, the closest first. With bounded loads, the full items come
+// after the others, so the first one is Get's.
+func (m *Map) GetN(key string, n int) []string {
+	if len(m.keys) == 0 || n < 1 {
+		return nil
+	}
+	if n > len(m.weights) {
+		n = len(m.weights)
+	}
+
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	items := make([]string, 0, n)
+	var full []string
+	for i := 0; i < len(m.keys) && len(items) < n; i++ {
+		item := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if contains(items, item) || contains(full, item) {
+			continue
+		}
+		if m.epsilon != 0 && m.loads[item]+1 > m.MaxLoad(item) {
+			full = append(full, item)
+			continue
+		}
+		items = append(items, item)
+	}
+	for i := 0; i < len(full) && len(items) < n; i++ {
+		items = append(items, full[i])
+	}
+	return items
+}
+
+// Bounded reports whether the map balances the keys by the loads.
+func (m *Map) Bounded() bool {
+	return m.epsilon != 0
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxLoad returns the load node may take with bounded loads, that is
+// (1+epsilon) times its weighted share of the load plus one.
+func (m *Map) MaxLoad(node string) int64 {
+	if m.total == 0 {
+		return 0
+	}
+	share := float64(m.load+1) * float64(m.weights[node]) / float64(m.total)
+	return int64(math.Ceil(share * (1 + m.epsilon)))
+}
+
+// Inc adds one to the load of node, for instance when a key is
+// assigned to it or a request is sent to it.
+func (m *Map) Inc(node string) {
+	if _, ok := m.weights[node]; ok {
+		m.loads[node]++
+		m.load++
+	}
+}
+
+// Done removes one from the load of node.
+func (m *Map) Done(node string) {
+	if m.loads[node] > 0 {
+		m.loads[node]--
+		m.load--
+	}
+}
+
+// Loads returns the current load of every node.
+func (m *Map) Loads() map[string]int64 {
+	loads := make(map[string]int64, len(m.weights))
+	for node := range m.weights {
+		loads[node] = m.loads[node]
+	}
+	return loads
+}
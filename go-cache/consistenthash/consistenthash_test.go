@@ -1,6 +1,7 @@
 package consistenthash
 
 import (
+	"math"
 	"strconv"
 	"testing"
 )
@@ -38,3 +39,191 @@ func TestHashing(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c")
+
+	owners := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		owners[key] = hash.Get(key)
+	}
+
+	hash.Remove("b")
+	if len(hash.keys) != 100 || len(hash.hashMap) != 100 {
+		t.Fatalf("expected 100 replicas left but got %d", len(hash.keys))
+	}
+	for key, owner := range owners {
+		got := hash.Get(key)
+		if owner == "b" && got == "b" {
+			t.Fatalf("Asking for %s, should not yield the removed b", key)
+		}
+		if owner != "b" && got != owner {
+			t.Errorf("Asking for %s, should still have yielded %s", key, owner)
+		}
+	}
+
+	// adding b back restores the original placement
+	hash.Add("b")
+	for key, owner := range owners {
+		if hash.Get(key) != owner {
+			t.Errorf("Asking for %s, should have yielded %s", key, owner)
+		}
+	}
+}
+
+// distribution returns how many of n keys each node owns.
+func distribution(m *Map, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[m.Get("key"+strconv.Itoa(i))]++
+	}
+	return counts
+}
+
+func TestAddWeighted(t *testing.T) {
+	hash := New(50, nil)
+	hash.AddWeighted("small", 1)
+	hash.AddWeighted("medium", 2)
+	hash.AddWeighted("large", 4)
+
+	const n = 70000
+	counts := distribution(hash, n)
+	t.Logf("distribution of %d keys: %v", n, counts)
+	for node, weight := range map[string]int{"small": 1, "medium": 2, "large": 4} {
+		expect := n * weight / 7
+		if got := counts[node]; got < expect*7/10 || got > expect*13/10 {
+			t.Errorf("%s owns %d keys, expected about %d", node, got, expect)
+		}
+	}
+
+	hash.Add("large")
+	if hash.weights["large"] != 4 || len(hash.keys) != 350 {
+		t.Fatalf("Add should keep the weight of a node already in the hash")
+	}
+	hash.Remove("large")
+	if len(hash.keys) != 150 || hash.total != 3 {
+		t.Fatalf("expected the 200 replicas of large to be removed, %d left", len(hash.keys))
+	}
+}
+
+func TestMovement(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c", "d")
+
+	const n = 10000
+	before := make([]string, n)
+	for i := range before {
+		before[i] = hash.Get("key" + strconv.Itoa(i))
+	}
+
+	hash.Add("e")
+	moved := 0
+	for i, owner := range before {
+		if got := hash.Get("key" + strconv.Itoa(i)); got != owner {
+			if got != "e" {
+				t.Fatalf("key%d moved from %s to %s instead of the new node", i, owner, got)
+			}
+			moved++
+		}
+	}
+	t.Logf("adding a 5th node moved %d of %d keys", moved, n)
+	if moved < n/10 || moved > n*3/10 {
+		t.Fatalf("expected about 1/5 of the keys to move, got %d", moved)
+	}
+}
+
+func TestBoundedLoads(t *testing.T) {
+	hash := NewBounded(50, 0.25, nil)
+	hash.Add("a", "b", "c", "d")
+
+	// assign keys for good, each one adding to the load of its owner
+	const n = 10000
+	for i := 0; i < n; i++ {
+		hash.Inc(hash.Get("key" + strconv.Itoa(i)))
+	}
+	loads := hash.Loads()
+	t.Logf("bounded distribution of %d keys: %v", n, loads)
+	for node, load := range loads {
+		if load > n/4*5/4+1 {
+			t.Errorf("%s has a load of %d above the bound", node, load)
+		}
+	}
+
+	hash.Done("a")
+	if hash.Loads()["a"] != loads["a"]-1 || hash.load != n-1 {
+		t.Fatalf("Done should release a unit of load")
+	}
+	hash.Remove("a")
+	if hash.load != n-loads["a"] {
+		t.Fatalf("removing a node should drop its load")
+	}
+}
+
+func TestBalance(t *testing.T) {
+	hash := New(50, nil)
+	for i := 0; i < 10; i++ {
+		hash.Add("node" + strconv.Itoa(i))
+	}
+	const n = 100000
+	counts := distribution(hash, n)
+
+	mean := float64(n) / 10
+	var variance, max float64
+	for _, c := range counts {
+		d := float64(c) - mean
+		variance += d * d / 10
+		max = math.Max(max, math.Abs(d)/mean)
+	}
+	t.Logf("%d keys on 10 nodes: stddev %.2f%% of the mean, max deviation %.2f%%",
+		n, math.Sqrt(variance)/mean*100, max*100)
+	if max > 0.5 {
+		t.Fatalf("a node is %.2f%% away from the mean", max*100)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	hash := New(50, nil)
+	for i := 0; i < 10; i++ {
+		hash.Add("node" + strconv.Itoa(i))
+	}
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hash.Get(keys[i%len(keys)])
+	}
+}
+
+func TestGetN(t *testing.T) {
+	m := New(50, nil)
+	if len(m.GetN("key", 2)) != 0 {
+		t.Fatalf("an empty map should not yield a node")
+	}
+	m.Add("a", "b", "c")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		items := m.GetN(key, 2)
+		if len(items) != 2 || items[0] != m.Get(key) || items[0] == items[1] {
+			t.Fatalf("expected %s to yield 2 distinct nodes, Get's first, got %v", key, items)
+		}
+	}
+	if len(m.GetN("key", 5)) != 3 {
+		t.Fatalf("GetN should yield at most every node")
+	}
+
+	b := NewBounded(50, 0.25, nil)
+	b.Add("a", "b", "c")
+	full := b.Get("key")
+	for i := 0; i < 10; i++ {
+		b.Inc(full)
+	}
+	items := b.GetN("key", 3)
+	if len(items) != 3 || items[0] != b.Get("key") || items[2] != full {
+		t.Fatalf("expected the full node %s last, got %v", full, items)
+	}
+}
@@ -0,0 +1,114 @@
+package gocache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// healthPath under the base path answers the health probes.
+	healthPath = "_health"
+
+	defaultMaxFailures = 5
+	defaultCooldown    = 10 * time.Second
+)
+
+// breaker is a circuit breaker which opens after consecutive failures
+// of a peer. Once open, the peer is skipped until it answers a health
+// probe or until the cooldown passes, then a single failure opens it
+// again.
+type breaker struct {
+	mu          sync.Mutex
+	maxFailures int // zero disables the breaker
+	cooldown    time.Duration
+	failures    int // consecutive
+	openUntil   time.Time
+}
+
+// open reports whether the peer must be skipped.
+func (b *breaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Now().Before(b.openUntil)
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openUntil = time.Time{}
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.maxFailures > 0 && b.failures >= b.maxFailures {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// WithCircuitBreaker makes the pool skip a peer after maxFailures
+// consecutive failed requests, its keys going to the next peer of the
+// placement, possibly this one. The peer is tried again once it
+// answers a health probe, or after cooldown. The default is 5
+// failures and 10 seconds, zero failures disables the breaker.
+func WithCircuitBreaker(maxFailures int, cooldown time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.maxFailures = maxFailures
+		p.cooldown = cooldown
+	}
+}
+
+// WithHealthCheck makes the pool probe every peer each interval, the
+// probes count as requests for the circuit breaker. Close stops them.
+func WithHealthCheck(interval time.Duration) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.healthInterval = interval
+	}
+}
+
+// Close stops the health probes of the pool.
+func (p *HTTPPool) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	return nil
+}
+
+func (p *HTTPPool) probeLoop() {
+	t := time.NewTicker(p.healthInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+			p.probe()
+		}
+	}
+}
+
+// probe concurrently probes every peer but this one.
+func (p *HTTPPool) probe() {
+	p.mu.RLock()
+	var getters []*httpGetter
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			getters = append(getters, getter)
+		}
+	}
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, getter := range getters {
+		wg.Add(1)
+		go func(getter *httpGetter) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), p.healthInterval)
+			defer cancel()
+			// probe updates the breaker
+			getter.probe(ctx)
+		}(getter)
+	}
+	wg.Wait()
+}
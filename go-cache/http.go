@@ -1,15 +1,20 @@
 package gocache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"go-cache/consistenthash"
 	pb "go-cache/xmcachepb"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -17,6 +22,12 @@ import (
 const (
 	defaultBasePath = "/_geecache/"
 	defaultReplicas = 50
+	// statsPath under the base path serves the stats of all groups.
+	statsPath = "_stats"
+	// batchPath under the base path serves the BatchRequests.
+	batchPath = "_batch"
+	// invalidatePath under the base path serves the InvalidateRequests.
+	invalidatePath = "_invalidate"
 )
 
 // HTTPPool implements PeerPicker for a poll of HTTP peers.
@@ -24,39 +35,248 @@ type HTTPPool struct {
 	// this perr's base URL. e.g. "https://example.net:9999"
 	self        string
 	basePath    string
-	mu          sync.Mutex // guards peers and httpGetters
-	peers       *consistenthash.Map
+	mu          sync.RWMutex // guards peers and httpGetters
+	peers       Placement
+	replication int                    // number of peers owning each key
 	httpGetters map[string]*httpGetter // keyed by e.g. "http://10.0.0.2:8008"
+
+	// circuit breaking of the peers, see WithCircuitBreaker
+	maxFailures    int
+	cooldown       time.Duration
+	healthInterval time.Duration // zero disables the health probes
+	done           chan struct{} // closed by Close
+	closeOnce      sync.Once
+
+	client *http.Client // of the requests to the peers
+	signer *signer      // nil without HMAC signing
+}
+
+// A HTTPPoolOption configures a HTTPPool created by NewHTTPPool.
+type HTTPPoolOption func(*HTTPPool)
+
+// WithPlacement sets how the pool decides which peer owns a key, the
+// default is a consistenthash.Map with 50 replicas per peer. The pool
+// adds the peers given to Set and AddWeightedPeers to placement, the
+// ones it already holds are skipped until then.
+func WithPlacement(placement Placement) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.peers = placement
+	}
+}
+
+// WithBasePath sets the path prefix of the requests between peers, the
+// default is "/_geecache/". It must end with a slash, and be the same
+// for every peer.
+func WithBasePath(basePath string) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.basePath = basePath
+	}
+}
+
+// WithReplication makes n peers own each key instead of one. The
+// groups load a key from its next owner when the previous ones fail.
+func WithReplication(n int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.replication = n
+	}
 }
 
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
+		self:        self,
+		basePath:    defaultBasePath,
+		peers:       consistenthash.New(defaultReplicas, nil),
+		replication: 1,
+		httpGetters: make(map[string]*httpGetter),
+		maxFailures: defaultMaxFailures,
+		cooldown:    defaultCooldown,
+		done:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	if p.healthInterval > 0 {
+		go p.probeLoop()
+	}
+	return p
 }
 
-// Set updates the pool's list of peers.
+// Set updates the pool's list of peers. The peers already in the
+// pool keep their keys and connections.
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	keep := make(map[string]bool, len(peers))
 	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+		keep[peer] = true
+	}
+	var removed []string
+	for peer := range p.httpGetters {
+		if !keep[peer] {
+			removed = append(removed, peer)
+		}
 	}
+	p.removePeers(removed...)
+	p.addPeers(peers...)
 }
 
-// PickPeer picks a peer according to key
-func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
+// AddPeers adds peers to the pool, only the keys they now own move.
+func (p *HTTPPool) AddPeers(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("Pick peer %s", peer)
-		return p.httpGetters[peer], true
+	p.addPeers(peers...)
+}
+
+// AddWeightedPeers adds peers to the pool, or changes their weight,
+// each owning a share of the keys proportional to its weight. The
+// placement must be a WeightedPlacement, else the weights are ignored.
+func (p *HTTPPool) AddWeightedPeers(weights map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	wp, ok := p.peers.(WeightedPlacement)
+	for peer, weight := range weights {
+		p.addGetter(peer)
+		if ok {
+			wp.AddWeighted(peer, weight)
+		} else {
+			p.peers.Add(peer)
+		}
 	}
-	return nil, false
+}
+
+// RemovePeers removes peers from the pool, only the keys they owned
+// move.
+func (p *HTTPPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removePeers(peers...)
+}
+
+// addPeers adds the new peers to the placement, the others keep their
+// weight.
+func (p *HTTPPool) addPeers(peers ...string) {
+	var added []string
+	for _, peer := range peers {
+		if p.addGetter(peer) {
+			added = append(added, peer)
+		}
+	}
+	if len(added) > 0 {
+		p.peers.Add(added...)
+	}
+}
+
+// addGetter creates the httpGetter of peer and reports whether it is
+// new.
+func (p *HTTPPool) addGetter(peer string) bool {
+	if _, ok := p.httpGetters[peer]; ok {
+		return false
+	}
+	p.httpGetters[peer] = &httpGetter{
+		baseURL: peer + p.basePath,
+		client:  p.client,
+		signer:  p.signer,
+		latency: newLatencies(),
+		breaker: breaker{maxFailures: p.maxFailures, cooldown: p.cooldown},
+		peer:    peer,
+		pool:    p,
+	}
+	return true
+}
+
+// trackLoad counts a request to peer in its load when the placement is
+// a bounded LoadPlacement, and returns the func ending it.
+func (p *HTTPPool) trackLoad(peer string) func() {
+	lp, ok := p.peers.(LoadPlacement)
+	if !ok || !lp.Bounded() {
+		return func() {}
+	}
+	p.mu.Lock()
+	lp.Inc(peer)
+	p.mu.Unlock()
+	return func() {
+		p.mu.Lock()
+		lp.Done(peer)
+		p.mu.Unlock()
+	}
+}
+
+func (p *HTTPPool) removePeers(peers ...string) {
+	var removed []string
+	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			delete(p.httpGetters, peer)
+			removed = append(removed, peer)
+		}
+	}
+	if len(removed) > 0 {
+		p.peers.Remove(removed...)
+	}
+}
+
+// PickPeer picks the peers owning key, skipping the ones whose circuit
+// breaker is open.
+func (p *HTTPPool) PickPeer(key string) ([]PeerGetter, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var owners []string
+	for _, peer := range p.peers.GetN(key, p.replication) {
+		if p.usable(peer) {
+			owners = append(owners, peer)
+		}
+	}
+	if len(owners) < p.replication {
+		// some owners are skipped, the next peers take their place
+		owners = owners[:0]
+		for _, peer := range p.peers.GetN(key, len(p.httpGetters)) {
+			if p.usable(peer) {
+				owners = append(owners, peer)
+			}
+			if len(owners) == p.replication {
+				break
+			}
+		}
+	}
+	if len(owners) == 0 {
+		return nil, true
+	}
+	var peers []PeerGetter
+	for _, peer := range owners {
+		if peer != p.self {
+			peers = append(peers, p.httpGetters[peer])
+		}
+	}
+	if owners[0] != p.self {
+		p.Log("Pick peer %s", owners[0])
+		return peers, false
+	}
+	return peers, true
+}
+
+// usable reports whether peer may own keys: it is this peer, or a peer
+// of the pool whose circuit breaker is closed. It is called with p.mu
+// held.
+func (p *HTTPPool) usable(peer string) bool {
+	if peer == p.self {
+		return true
+	}
+	getter, ok := p.httpGetters[peer]
+	return ok && !getter.open()
+}
+
+// GetAll returns all the peers in the pool except this one, skipping
+// the ones whose circuit breaker is open so that the writes and
+// invalidations don't wait on them.
+func (p *HTTPPool) GetAll() []PeerGetter {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var peers []PeerGetter
+	for peer, getter := range p.httpGetters {
+		if peer != p.self && !getter.open() {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
 }
 
 func (p *HTTPPool) Log(format string, v ...interface{}) {
@@ -68,6 +288,36 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		panic("HTTPPool serving unexpected path: " + r.URL.Path)
 	}
 	p.Log("%s %s", r.Method, r.URL.Path)
+	// bound the bodies read before they are authenticated
+	r.Body = http.MaxBytesReader(w, r.Body, maxFrameSize)
+	if p.signer != nil {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := p.signer.verify(r, body); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	if r.URL.Path == p.basePath+statsPath {
+		p.serveStats(w)
+		return
+	}
+	if r.URL.Path == p.basePath+healthPath {
+		w.Write([]byte("ok"))
+		return
+	}
+	if r.URL.Path == p.basePath+batchPath {
+		p.serveBatch(w, r)
+		return
+	}
+	if r.URL.Path == p.basePath+invalidatePath {
+		p.serveInvalidate(w, r)
+		return
+	}
 	// /<basepath>/<groupname>/<key> required
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -84,14 +334,87 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	view, err := group.Get(key)
-	if err != nil {
+	switch r.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		in := &pb.SetRequest{}
+		if err = proto.Unmarshal(body, in); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		group.setLocally(key, setRequestView(in))
+		return
+	case http.MethodDelete:
+		group.removeLocally(key)
+		return
+	}
+
+	group.counters.ServerRequests.Add(1)
+	view, err := group.GetContext(r.Context(), key)
+	res := errResponse(err)
+	if err != nil && res == nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if res == nil {
+		res = viewResponse(view)
+	}
 
 	// write the value to the reponse body as a proto message.
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	body, err := proto.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(body)
+}
+
+// serveStats writes the stats of every group as a JSON object keyed
+// by group name.
+func (p *HTTPPool) serveStats(w http.ResponseWriter) {
+	stats := make(map[string]Stats)
+	for _, g := range allGroups() {
+		stats[g.name] = g.Stats()
+	}
+	body, err := json.Marshal(stats)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
+
+// serveBatch answers the BatchRequest in the body of r.
+func (p *HTTPPool) serveBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &pb.BatchRequest{}
+	if err = proto.Unmarshal(body, in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group := GetGroup(in.Group)
+	if group == nil {
+		http.Error(w, "no such group: "+in.Group, http.StatusNotFound)
+		return
+	}
+
+	group.counters.ServerRequests.Add(1)
+	values, errs := group.getMany(r.Context(), in.Keys)
+	body, err = proto.Marshal(batchResponse(in.Keys, values, errs))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -100,30 +423,137 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+// serveInvalidate answers the InvalidateRequest in the body of r.
+func (p *HTTPPool) serveInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in := &pb.InvalidateRequest{}
+	if err = proto.Unmarshal(body, in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if in.Tag == "" && in.Prefix == "" {
+		http.Error(w, "tag or prefix required", http.StatusBadRequest)
+		return
+	}
+	group := GetGroup(in.Group)
+	if group == nil {
+		http.Error(w, "no such group: "+in.Group, http.StatusNotFound)
+		return
+	}
+	group.invalidateLocally(in)
+}
+
 type httpGetter struct {
 	baseURL string
+	client  *http.Client          // http.DefaultClient when nil
+	signer  *signer               // nil without HMAC signing
+	latency map[string]*histogram // of the requests, by method
+	breaker
+	peer string
+	pool *HTTPPool // nil for the getters made outside a pool
 }
 
-func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf(
+func (h *httpGetter) url(group, key string) string {
+	return fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.PathEscape(group),
+		url.PathEscape(key),
 	)
-	res, err := http.Get(u)
+}
+
+func (h *httpGetter) do(ctx context.Context, method, u string, body []byte) ([]byte, error) {
+	return h.roundTrip(ctx, method, u, body, true)
+}
+
+// probe requests the health of the peer, updating its breaker. Unlike
+// the other requests, it is neither recorded in the latency of the
+// peer nor counted in its load.
+func (h *httpGetter) probe(ctx context.Context) error {
+	_, err := h.roundTrip(ctx, http.MethodGet, h.baseURL+healthPath, nil, false)
+	return err
+}
+
+func (h *httpGetter) roundTrip(ctx context.Context, method, u string, body []byte, record bool) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if h.signer != nil {
+		if err := h.signer.sign(req, body); err != nil {
+			return nil, err
+		}
+	}
+	client := h.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if record {
+		defer h.observeLatency(method, time.Now())
+		if h.pool != nil {
+			defer h.pool.trackLoad(h.peer)()
+		}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		// the caller giving up is not the peer's failure
+		if ctx.Err() != context.Canceled {
+			h.failure()
+		}
+		return nil, err
 	}
 	defer res.Body.Close()
 
+	// the loader errors of the peer are not its failures
+	switch res.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		h.failure()
+	default:
+		h.success()
+	}
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+		return nil, fmt.Errorf("server returned: %v", res.Status)
 	}
 
 	bytes, err := ioutil.ReadAll(res.Body)
 	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	return bytes, nil
+}
+
+func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	bytes, err := h.do(ctx, http.MethodGet, h.url(in.GetGroup(), in.GetKey()), nil)
+	if err != nil {
+		return err
+	}
+
+	if err = proto.Unmarshal(bytes, out); err != nil {
+		return fmt.Errorf("decoding response body: %v", err)
+	}
+	return responseErr(out)
+}
+
+func (h *httpGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	bytes, err := h.do(ctx, http.MethodPost, h.baseURL+batchPath, body)
+	if err != nil {
+		return err
 	}
 
 	if err = proto.Unmarshal(bytes, out); err != nil {
@@ -131,3 +561,26 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	}
 	return nil
 }
+
+func (h *httpGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	_, err = h.do(ctx, http.MethodPut, h.url(in.GetGroup(), in.GetKey()), body)
+	return err
+}
+
+func (h *httpGetter) Remove(ctx context.Context, in *pb.Request) error {
+	_, err := h.do(ctx, http.MethodDelete, h.url(in.GetGroup(), in.GetKey()), nil)
+	return err
+}
+
+func (h *httpGetter) Invalidate(ctx context.Context, in *pb.InvalidateRequest) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	_, err = h.do(ctx, http.MethodPost, h.baseURL+invalidatePath, body)
+	return err
+}
@@ -0,0 +1,285 @@
+package gocache
+
+import (
+	"context"
+	"go-cache/consistenthash"
+	"go-cache/jump"
+	"go-cache/rendezvous"
+	pb "go-cache/xmcachepb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPPoolMembership(t *testing.T) {
+	p := NewHTTPPool("http://self")
+	if peers, primary := p.PickPeer("key"); !primary || len(peers) > 0 {
+		t.Fatalf("an empty pool should not pick a peer")
+	}
+	p.Set("http://a", "http://b")
+	getter := p.httpGetters["http://a"]
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				p.PickPeer(strconv.Itoa(i))
+			}
+		}
+	}()
+
+	p.AddPeers("http://c", "http://a")
+	p.RemovePeers("http://b", "http://d")
+	close(stop)
+	wg.Wait()
+
+	if len(p.httpGetters) != 2 || len(p.GetAll()) != 2 {
+		t.Fatalf("expected peers a and c but got %v", p.httpGetters)
+	}
+	if p.httpGetters["http://a"] != getter {
+		t.Fatalf("peers already in the pool should keep their getter")
+	}
+
+	p.Set("http://a", "http://self")
+	if len(p.httpGetters) != 2 || p.httpGetters["http://a"] != getter {
+		t.Fatalf("Set should only replace the peers which changed")
+	}
+	if len(p.GetAll()) != 1 {
+		t.Fatalf("GetAll should skip this peer")
+	}
+}
+
+func TestHTTPPoolPlacement(t *testing.T) {
+	placements := map[string]Placement{
+		"consistenthash": consistenthash.New(defaultReplicas, nil),
+		"rendezvous":     rendezvous.New(nil),
+		"jump":           jump.New(nil),
+	}
+	for name, placement := range placements {
+		p := NewHTTPPool("http://self", WithPlacement(placement))
+		p.Set("http://self", "http://a", "http://b")
+
+		counts := make(map[PeerGetter]int)
+		for i := 0; i < 3000; i++ {
+			peers, primary := p.PickPeer(strconv.Itoa(i))
+			if !primary {
+				counts[peers[0]]++
+			}
+		}
+		if len(counts) != 2 || counts[p.httpGetters["http://a"]] < 500 {
+			t.Fatalf("%s: expected keys spread over a and b, got %v", name, counts)
+		}
+	}
+}
+
+func TestHTTPPoolPrefilledPlacement(t *testing.T) {
+	m := consistenthash.New(50, nil)
+	m.Add("http://a")
+	p := NewHTTPPool("http://self", WithPlacement(m))
+	if _, primary := p.PickPeer("k"); !primary {
+		t.Fatalf("expected a peer missing from the pool to be skipped")
+	}
+	p.Set("http://self", "http://b")
+	for i := 0; i < 100; i++ {
+		if peers, primary := p.PickPeer(strconv.Itoa(i)); !primary && peers[0] != p.httpGetters["http://b"] {
+			t.Fatalf("expected the keys of a peer missing from the pool to go to the next peer")
+		}
+	}
+}
+
+func TestHTTPPoolReplication(t *testing.T) {
+	p := NewHTTPPool("http://self", WithReplication(2))
+	p.Set("http://self", "http://a", "http://b")
+
+	var primaries, replicas int
+	for i := 0; i < 3000; i++ {
+		peers, primary := p.PickPeer(strconv.Itoa(i))
+		switch {
+		case primary && len(peers) == 1:
+			primaries++
+		case !primary && len(peers) == 1:
+			replicas++
+		case !primary && len(peers) == 2 && peers[0] != peers[1]:
+		default:
+			t.Fatalf("unexpected owners %v, primary %v", peers, primary)
+		}
+	}
+	if primaries < 500 || replicas < 500 {
+		t.Fatalf("expected this peer to own about 2/3 of the keys, got %d primaries and %d replicas", primaries, replicas)
+	}
+}
+
+func TestHTTPPoolCircuitBreaker(t *testing.T) {
+	srv := httptest.NewServer(NewHTTPPool("dead"))
+	dead := srv.URL
+	srv.Close()
+
+	p := NewHTTPPool("http://self", WithCircuitBreaker(2, time.Hour))
+	p.Set("http://self", dead)
+	var key string
+	for i := 0; ; i++ {
+		if peers, primary := p.PickPeer(strconv.Itoa(i)); !primary && len(peers) == 1 {
+			key = strconv.Itoa(i)
+			break
+		}
+	}
+
+	getter := p.httpGetters[dead]
+	for i := 0; i < 2; i++ {
+		if err := getter.Get(context.Background(), &pb.Request{Group: "breaker", Key: key}, &pb.Response{}); err == nil {
+			t.Fatalf("expected the dead peer to fail")
+		}
+	}
+	if peers, primary := p.PickPeer(key); !primary || len(peers) != 0 {
+		t.Fatalf("expected the keys of an open peer to be owned locally, got %v", peers)
+	}
+
+	getter.success()
+	if _, primary := p.PickPeer(key); primary {
+		t.Fatalf("expected the peer to own its keys again once recovered")
+	}
+}
+
+func TestHTTPPoolWritesSkipOpenPeers(t *testing.T) {
+	hang := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hang
+	}))
+	defer srv.Close()
+	defer close(hang)
+
+	xm := NewGroup("skip-open", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, ErrNotFound
+		}))
+	p := NewHTTPPool("http://self", WithCircuitBreaker(1, time.Hour))
+	p.Set("http://self", srv.URL)
+	p.httpGetters[srv.URL].failure()
+	xm.RegisterPeers(p)
+
+	done := make(chan error)
+	go func() {
+		done <- xm.Set("k", []byte("v"))
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected Set to skip the peer whose breaker is open")
+	}
+}
+
+func TestHTTPPoolHealthCheck(t *testing.T) {
+	peer := NewHTTPPool("peer")
+	srv := httptest.NewServer(peer)
+	defer srv.Close()
+
+	p := NewHTTPPool("http://self", WithCircuitBreaker(1, time.Hour), WithHealthCheck(5*time.Millisecond))
+	defer p.Close()
+	p.Set(srv.URL)
+	getter := p.httpGetters[srv.URL]
+	getter.failure()
+	if !getter.open() {
+		t.Fatalf("expected the breaker to open")
+	}
+	if !waitFor(func() bool { return !getter.open() }) {
+		t.Fatalf("expected a health probe to close the breaker")
+	}
+	hist := getter.latency["GET"]
+	hist.mu.Lock()
+	count := hist.count
+	hist.mu.Unlock()
+	if count != 0 {
+		t.Fatalf("expected the probes to stay out of the latency, got %d requests", count)
+	}
+
+	srv.Close()
+	if !waitFor(getter.open) {
+		t.Fatalf("expected the health probes to open the breaker of a dead peer")
+	}
+}
+
+func TestHTTPPoolKeyEscaping(t *testing.T) {
+	NewGroup("escaping", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	srv := httptest.NewServer(NewHTTPPool("peer"))
+	defer srv.Close()
+	p := NewHTTPPool("http://self")
+	p.Set(srv.URL)
+
+	for _, key := range []string{"a b", "a+b", "a/b?c#d%"} {
+		res := &pb.Response{}
+		if err := p.httpGetters[srv.URL].Get(context.Background(), &pb.Request{Group: "escaping", Key: key}, res); err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Value) != key {
+			t.Fatalf("expected the peer to load %q, got %q", key, res.Value)
+		}
+	}
+}
+
+func TestHTTPPoolWeightedPeers(t *testing.T) {
+	owned := func(p *HTTPPool, peer string) (n int) {
+		for i := 0; i < 10000; i++ {
+			if p.peers.Get(strconv.Itoa(i)) == peer {
+				n++
+			}
+		}
+		return
+	}
+
+	m := consistenthash.New(defaultReplicas, nil)
+	m.AddWeighted("http://big", 10)
+	p := NewHTTPPool("http://self", WithPlacement(m))
+	p.Set("http://big", "http://small")
+	if big := owned(p, "http://big"); big < 8000 {
+		t.Fatalf("expected the big peer to keep its weight, it owns %d keys", big)
+	}
+
+	p = NewHTTPPool("http://self")
+	p.AddWeightedPeers(map[string]int{"http://big": 10, "http://small": 1})
+	p.Set("http://big", "http://small")
+	if big := owned(p, "http://big"); big < 8000 {
+		t.Fatalf("expected the big peer to keep its weight, it owns %d keys", big)
+	}
+}
+
+func TestHTTPPoolBoundedLoads(t *testing.T) {
+	p := NewHTTPPool("http://self", WithPlacement(consistenthash.NewBounded(defaultReplicas, 0.25, nil)))
+	p.Set("http://self", "http://a", "http://b")
+	var key string
+	for i := 0; ; i++ {
+		if peers, _ := p.PickPeer(strconv.Itoa(i)); len(peers) == 1 && peers[0] == p.httpGetters["http://a"] {
+			key = strconv.Itoa(i)
+			break
+		}
+	}
+
+	// a's requests in flight exceed its share of the load
+	var done []func()
+	for i := 0; i < 10; i++ {
+		done = append(done, p.trackLoad("http://a"))
+	}
+	if peers, _ := p.PickPeer(key); len(peers) == 1 && peers[0] == p.httpGetters["http://a"] {
+		t.Fatalf("expected the key of a loaded peer to move")
+	}
+	for _, d := range done {
+		d()
+	}
+	if peers, _ := p.PickPeer(key); len(peers) != 1 || peers[0] != p.httpGetters["http://a"] {
+		t.Fatalf("expected the key to return to its owner once the load is gone")
+	}
+}
@@ -0,0 +1,92 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "go-cache/xmcachepb"
+	"log"
+	"strings"
+)
+
+// An Invalidator is a PeerGetter which also drops the values of a group
+// matching an InvalidateRequest, as the peers of HTTPPool and RPCPool
+// do.
+type Invalidator interface {
+	Invalidate(ctx context.Context, in *pb.InvalidateRequest) error
+}
+
+var errNotInvalidator = errors.New("gocache: peer can't invalidate, it may keep stale values")
+
+// InvalidateTag drops the values tagged with tag by a ResultGetter
+// from the cache of every peer. The peers which are not Invalidators
+// can't drop their values, they make it fail after the other peers
+// did.
+func (g *Group) InvalidateTag(tag string) error {
+	return g.InvalidateTagContext(context.Background(), tag)
+}
+
+// InvalidateTagContext is like InvalidateTag, but gives up on the
+// peers once ctx is done.
+func (g *Group) InvalidateTagContext(ctx context.Context, tag string) error {
+	if tag == "" {
+		return fmt.Errorf("tag is required")
+	}
+	return g.invalidate(ctx, &pb.InvalidateRequest{Group: g.name, Tag: tag})
+}
+
+// InvalidatePrefix drops the keys starting with prefix from the cache
+// of every peer, including the ones remembered as not found. The
+// peers which are not Invalidators make it fail like InvalidateTag.
+func (g *Group) InvalidatePrefix(prefix string) error {
+	return g.InvalidatePrefixContext(context.Background(), prefix)
+}
+
+// InvalidatePrefixContext is like InvalidatePrefix, but gives up on
+// the peers once ctx is done.
+func (g *Group) InvalidatePrefixContext(ctx context.Context, prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("prefix is required")
+	}
+	return g.invalidate(ctx, &pb.InvalidateRequest{Group: g.name, Prefix: prefix})
+}
+
+func (g *Group) invalidate(ctx context.Context, in *pb.InvalidateRequest) error {
+	g.invalidateLocally(in)
+	if g.peers == nil {
+		return nil
+	}
+	ctx, cancel := peerContext(ctx)
+	defer cancel()
+	return forEachPeer(g.peers.GetAll(), func(peer PeerGetter) error {
+		inv, ok := peer.(Invalidator)
+		if !ok {
+			return errNotInvalidator
+		}
+		err := inv.Invalidate(ctx, in)
+		if err != nil {
+			log.Println("[XmCache] Failed to invalidate on peer", err)
+		}
+		return err
+	})
+}
+
+// invalidateLocally drops the values matching in from the caches.
+func (g *Group) invalidateLocally(in *pb.InvalidateRequest) {
+	match := func(key string, value ByteView) bool {
+		if in.Prefix != "" {
+			return strings.HasPrefix(key, in.Prefix)
+		}
+		for _, tag := range value.tags {
+			if tag == in.Tag {
+				return true
+			}
+		}
+		return false
+	}
+	g.mainCache.removeFunc(match)
+	g.hotCache.removeFunc(match)
+	if in.Prefix != "" {
+		g.negCache.removeFunc(match)
+	}
+}
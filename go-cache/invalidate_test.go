@@ -0,0 +1,145 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	pb "go-cache/xmcachepb"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// userGetter tags the keys "user:<id>:..." with "user:<id>".
+var userGetter = ResultGetterFunc(func(ctx context.Context, key string) (Result, error) {
+	parts := strings.SplitN(key, ":", 3)
+	return Result{Value: []byte(key), Tags: []string{parts[0] + ":" + parts[1]}}, nil
+})
+
+func TestInvalidate(t *testing.T) {
+	g := NewGroup("invalidate", 2<<10, userGetter, WithNegativeCache(time.Minute, 2<<10))
+	for _, key := range []string{"user:1:a", "user:1:b", "user:2:a", "user:2:b"} {
+		if v, err := g.Get(key); err != nil || len(v.Tags()) != 1 {
+			t.Fatalf("expected %s to be tagged, got %v, %v", key, v.Tags(), err)
+		}
+	}
+	g.populateNegative("user:2:c")
+
+	if err := g.InvalidateTag("user:1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.InvalidatePrefix("user:2:"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"user:1:a", "user:1:b", "user:2:a", "user:2:b"} {
+		if _, ok := g.mainCache.get(key); ok {
+			t.Fatalf("expected %s to be invalidated", key)
+		}
+	}
+	if g.lookupNegative("user:2:c") {
+		t.Fatalf("expected the prefix to drop the negative entries")
+	}
+	if err := g.InvalidatePrefix(""); err == nil {
+		t.Fatalf("expected an empty prefix to be rejected")
+	}
+}
+
+// batchUserGetter is userGetter loading several keys at once.
+type batchUserGetter struct {
+	ResultGetterFunc
+}
+
+func (g batchUserGetter) GetMany(keys []string) (map[string][]byte, error) {
+	panic("GetManyResults is expected to be used")
+}
+
+func (g batchUserGetter) GetManyResults(ctx context.Context, keys []string) (map[string]Result, error) {
+	results := make(map[string]Result, len(keys))
+	for _, key := range keys {
+		res, err := g.GetResult(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		res.TTL = time.Hour
+		results[key] = res
+	}
+	return results, nil
+}
+
+func TestResultGetter(t *testing.T) {
+	g := NewGroup("result", 2<<10, ResultGetterFunc(
+		func(ctx context.Context, key string) (Result, error) {
+			return Result{Value: []byte(key), TTL: time.Hour, Tags: []string{"t"}}, nil
+		}), WithTTL(time.Second))
+	v, err := g.Get("k")
+	if err != nil || len(v.Tags()) != 1 || time.Until(v.Expire()) < time.Minute {
+		t.Fatalf("expected the TTL and tags of the result, got %v, %v, %v", v.Expire(), v.Tags(), err)
+	}
+
+	batch := NewGroup("result-batch", 2<<10, batchUserGetter{userGetter})
+	values, err := batch.GetMany([]string{"user:1:a", "user:1:b", "user:2:a"})
+	if err != nil || len(values) != 3 {
+		t.Fatalf("GetMany failed: %v, %v", values, err)
+	}
+	for key, v := range values {
+		if len(v.Tags()) != 1 || time.Until(v.Expire()) < time.Minute {
+			t.Fatalf("expected %s to keep the TTL and tags of its result, got %v, %v", key, v.Expire(), v.Tags())
+		}
+	}
+	batch.InvalidateTag("user:1")
+	if _, ok := batch.mainCache.get("user:1:a"); ok {
+		t.Fatalf("expected the values loaded by GetMany to be invalidated by tag")
+	}
+}
+
+func TestInvalidateSnapshot(t *testing.T) {
+	g := NewGroup("invalidate-snapshot", 2<<10, userGetter)
+	g.Get("user:1:a")
+	var buf bytes.Buffer
+	if err := g.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewGroup("invalidate-restored", 2<<10, userGetter)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored.InvalidateTag("user:1")
+	if _, ok := restored.mainCache.get("user:1:a"); ok {
+		t.Fatalf("expected the restored value to keep its tags")
+	}
+}
+
+func TestHTTPPoolInvalidate(t *testing.T) {
+	g := NewGroup("invalidate-http", 2<<10, userGetter)
+	var received []*pb.InvalidateRequest
+	peer := NewHTTPPool("peer")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, invalidatePath) {
+			body, _ := ioutil.ReadAll(r.Body)
+			in := &pb.InvalidateRequest{}
+			proto.Unmarshal(body, in)
+			received = append(received, in)
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		peer.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	p := NewHTTPPool("http://self")
+	p.Set("http://self", srv.URL)
+	g.RegisterPeers(p)
+	if err := g.InvalidateTag("user:1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.InvalidatePrefix("user:2:"); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].Tag != "user:1" || received[1].Prefix != "user:2:" ||
+		received[0].Group != "invalidate-http" {
+		t.Fatalf("expected the invalidations to reach the peer, got %v", received)
+	}
+}
@@ -0,0 +1,97 @@
+package jump
+
+// Hash maps bytes to uint64
+type Hash func(data []byte) uint64
+
+// Map places keys with Jump Consistent Hash, which needs no memory
+// besides the list of nodes and spreads keys evenly. Adding a node
+// only moves keys to it, but removing a node other than the last
+// added one moves the keys of the nodes after it too. Get and GetN may
+// be called concurrently, the other methods may not.
+type Map struct {
+	hash  Hash
+	nodes []string
+}
+
+func New(fn Hash) *Map {
+	return &Map{hash: fn}
+}
+
+// hashKey hashes key with the Hash of the map, or else with FNV-1a
+// without converting key to bytes.
+func (m *Map) hashKey(key string) uint64 {
+	if m.hash != nil {
+		return m.hash([]byte(key))
+	}
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// Add adds some keys to the hash.
+func (m *Map) Add(keys ...string) {
+	for _, key := range keys {
+		if m.index(key) < 0 {
+			m.nodes = append(m.nodes, key)
+		}
+	}
+}
+
+// Remove removes some keys from the hash.
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		if i := m.index(key); i >= 0 {
+			m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+		}
+	}
+}
+
+func (m *Map) index(key string) int {
+	for i, node := range m.nodes {
+		if node == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get gets the item the provided key jumps to.
+func (m *Map) Get(key string) string {
+	if len(m.nodes) == 0 {
+		return ""
+	}
+	return m.nodes[Bucket(m.hashKey(key), len(m.nodes))]
+}
+
+// GetN gets up to n items for the provided key: the one it jumps to
+// followed by the next ones in the order they were added.
+func (m *Map) GetN(key string, n int) []string {
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	if n < 1 {
+		return nil
+	}
+	b := Bucket(m.hashKey(key), len(m.nodes))
+	items := make([]string, n)
+	for i := range items {
+		items[i] = m.nodes[(b+i)%len(m.nodes)]
+	}
+	return items
+}
+
+// Bucket returns the bucket in [0, buckets) of key, as described in
+// "A Fast, Minimal Memory, Consistent Hash Algorithm" by Lamping and
+// Veach.
+func Bucket(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
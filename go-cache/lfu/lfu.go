@@ -0,0 +1,177 @@
+package lfu
+
+import (
+	"container/heap"
+	"go-cache/lru"
+	"sort"
+	"time"
+)
+
+// Value use Len to count how many bytes it takes
+type Value = lru.Value
+
+// Cache is a LFU cache, it evicts the least frequently used entry and
+// the least recently used one among equally used entries. It is not
+// safe for concurrent access.
+type Cache struct {
+	maxBytes int64
+	nbytes   int64
+	tick     uint64 // logical clock ordering accesses
+	queue    queue
+	cache    map[string]*entry
+	// optional and exectued when an entry is purged.
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	value  Value
+	expire time.Time // zero means the entry never expires
+	freq   uint64
+	tick   uint64 // last access
+	index  int    // index in the heap
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+// queue is a min-heap of entries ordered by frequency then recency.
+type queue []*entry
+
+func (q queue) Len() int { return len(q) }
+
+func (q queue) Less(i, j int) bool {
+	if q[i].freq == q[j].freq {
+		return q[i].tick < q[j].tick
+	}
+	return q[i].freq < q[j].freq
+}
+
+func (q queue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *queue) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*q)
+	*q = append(*q, e)
+}
+
+func (q *queue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return e
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*entry),
+		OnEvicted: onEvicted,
+	}
+}
+
+func (c *Cache) touch(e *entry) {
+	c.tick++
+	e.freq++
+	e.tick = c.tick
+	heap.Fix(&c.queue, e.index)
+}
+
+// Get looks up a key's value and counts the access. Expired entries
+// are removed and reported as a miss.
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	if e, ok := c.cache[key]; ok {
+		if e.expired(time.Now()) {
+			c.removeEntry(e)
+			return nil, false
+		}
+		c.touch(e)
+		return e.value, true
+	}
+	return
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if e, ok := c.cache[key]; ok {
+		c.removeEntry(e)
+	}
+}
+
+// RemoveOldest removes the least frequently used entry.
+func (c *Cache) RemoveOldest() {
+	if len(c.queue) > 0 {
+		c.removeEntry(c.queue[0])
+	}
+}
+
+// RemoveExpired removes all entries whose expiry has passed.
+func (c *Cache) RemoveExpired() {
+	now := time.Now()
+	for _, e := range c.cache {
+		if e.expired(now) {
+			c.removeEntry(e)
+		}
+	}
+}
+
+func (c *Cache) removeEntry(e *entry) {
+	heap.Remove(&c.queue, e.index)
+	delete(c.cache, e.key)
+	c.nbytes -= int64(len(e.key)) + int64(e.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(e.key, e.value)
+	}
+}
+
+// Add adds a value that never expires to the cache.
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache which expires at expire.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if e, ok := c.cache[key]; ok {
+		c.nbytes += int64(value.Len()) - int64(e.value.Len())
+		e.value = value
+		e.expire = expire
+		c.touch(e)
+	} else {
+		c.tick++
+		e := &entry{key: key, value: value, expire: expire, freq: 1, tick: c.tick}
+		heap.Push(&c.queue, e)
+		c.cache[key] = e
+		c.nbytes += int64(len(key)) + int64(value.Len())
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// Walk calls fn for every entry, from the least frequently used to
+// the most.
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	q := make(queue, len(c.queue))
+	copy(q, c.queue)
+	sort.Slice(q, q.Less)
+	for _, e := range q {
+		fn(e.key, e.value, e.expire)
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.queue)
+}
+
+// Bytes returns the number of bytes taken by the keys and values.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -0,0 +1,63 @@
+package lfu
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveOldest(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+	lfu := New(int64(8), callback)
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k2")
+	// new keys are used less than k1 and k2, so they are evicted first
+	lfu.Add("k3", String("v3"))
+	lfu.Add("k4", String("v4"))
+
+	expect := []string{"k3", "k4"}
+	if !reflect.DeepEqual(expect, keys) || lfu.Len() != 2 {
+		t.Fatalf("Call OnEvicted failed, expect keys equals to %s but got %s", expect, keys)
+	}
+	if _, ok := lfu.Get("k1"); !ok {
+		t.Fatalf("the most frequently used k1 should be kept")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.AddWithExpire("key1", String("1"), time.Now().Add(-time.Second))
+	lfu.Add("key2", String("2"))
+	lfu.RemoveExpired()
+
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 1 {
+		t.Fatalf("RemoveExpired key1 failed")
+	}
+	if lfu.Bytes() != int64(len("key2")+len("2")) {
+		t.Fatal("expected 5 but got", lfu.Bytes())
+	}
+}
@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -37,6 +38,21 @@ func TestCache_RemoveOldest(t *testing.T) {
 	}
 }
 
+func TestRemove(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("key1", String("1234"))
+	lru.Add("key2", String("5678"))
+	lru.Remove("key1")
+	lru.Remove("key3")
+
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatalf("Remove key1 failed")
+	}
+	if lru.nbytes != int64(len("key2")+len("5678")) {
+		t.Fatal("expected 8 but got", lru.nbytes)
+	}
+}
+
 func TestOnEvicted(t *testing.T) {
 	keys := make([]string, 0)
 	callback := func(key string, value Value) {
@@ -63,3 +79,42 @@ func TestAdd(t *testing.T) {
 		t.Fatal("expected 6 but got", lru.nbytes)
 	}
 }
+
+func TestExpire(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.AddWithExpire("key1", String("1"), time.Now().Add(-time.Second))
+	lru.AddWithExpire("key2", String("2"), time.Now().Add(time.Hour))
+	lru.Add("key3", String("3"))
+
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 2 {
+		t.Fatalf("expired key1 should be a miss and removed")
+	}
+	if _, ok := lru.Get("key2"); !ok {
+		t.Fatalf("cache hit key2 failed")
+	}
+
+	lru.AddWithExpire("key2", String("2"), time.Now().Add(-time.Second))
+	lru.RemoveExpired()
+	if _, ok := lru.Get("key3"); !ok || lru.Len() != 1 {
+		t.Fatalf("RemoveExpired failed, %d entries left", lru.Len())
+	}
+	if lru.nbytes != int64(len("key3")+len("3")) {
+		t.Fatal("expected 5 but got", lru.nbytes)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	lru := New(int64(0), nil)
+	lru.Add("k1", String("1"))
+	lru.Add("k2", String("2"))
+	lru.Add("k3", String("3"))
+	lru.Get("k1")
+
+	var keys []string
+	lru.Walk(func(key string, value Value, expire time.Time) {
+		keys = append(keys, key)
+	})
+	if !reflect.DeepEqual(keys, []string{"k2", "k3", "k1"}) {
+		t.Fatalf("expected the least recently used first, got %v", keys)
+	}
+}
@@ -0,0 +1,171 @@
+package gocache
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// A MemoryManager bounds the memory of several groups as a whole,
+// instead of each group having a budget of its own. A busy group may
+// use the memory the others leave idle, and once the manager is full
+// the group using the most compared to its share gives memory back.
+type MemoryManager struct {
+	maxBytes int64
+	mu       sync.Mutex        // guards groups and weights
+	groups   map[string]*Group // by name
+	weights  int               // sum of the groups' weights
+	// all holds the []*Group of groups, replaced on register, so that
+	// inserts add up the usage of the groups without locking
+	all atomic.Value
+}
+
+// A Share is the part of a MemoryManager's memory granted to a group.
+type Share struct {
+	// Weight of the group compared to the others, its fair share
+	// of the memory is maxBytes*Weight/(sum of the weights). Zero
+	// counts as 1.
+	Weight int
+	// MinBytes the group keeps even when others need memory.
+	MinBytes int64
+	// MaxBytes the group uses even when memory is idle, zero means
+	// no limit.
+	MaxBytes int64
+}
+
+// GroupUsage is the memory used by a group of a MemoryManager.
+type GroupUsage struct {
+	Group     string `json:"group"`
+	Bytes     int64  `json:"bytes"`      // of the main and hot caches
+	FairBytes int64  `json:"fair_bytes"` // given by the group's weight
+	MinBytes  int64  `json:"min_bytes"`
+	MaxBytes  int64  `json:"max_bytes"`
+}
+
+// NewMemoryManager returns a MemoryManager holding at most maxBytes
+// in the caches of its groups.
+func NewMemoryManager(maxBytes int64) *MemoryManager {
+	return &MemoryManager{maxBytes: maxBytes, groups: make(map[string]*Group)}
+}
+
+// WithMemoryManager makes m bound the main and hot caches of the
+// group according to share, the cacheBytes given to NewGroup is
+// ignored. The policies of the caches choose what to keep within
+// share.MaxBytes, or the manager's maxBytes when it is zero. The
+// negative cache keeps its own budget.
+func WithMemoryManager(m *MemoryManager, share Share) GroupOption {
+	return func(g *Group) {
+		if share.Weight <= 0 {
+			share.Weight = 1
+		}
+		g.memory = m
+		g.share = share
+	}
+}
+
+// register adds g to the manager, replacing the group of the same
+// name if any.
+func (m *MemoryManager) register(g *Group) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.groups[g.name]; ok {
+		m.weights -= old.share.Weight
+	}
+	m.groups[g.name] = g
+	m.weights += g.share.Weight
+	all := make([]*Group, 0, len(m.groups))
+	for _, mg := range m.groups {
+		all = append(all, mg)
+	}
+	m.all.Store(all)
+}
+
+// total returns the memory used by the groups.
+func (m *MemoryManager) total() int64 {
+	var total int64
+	all, _ := m.all.Load().([]*Group)
+	for _, g := range all {
+		total += g.bytes()
+	}
+	return total
+}
+
+// fairBytes returns the memory due to g given its weight.
+func (m *MemoryManager) fairBytes(g *Group) int64 {
+	if fair := m.maxBytes * int64(g.share.Weight) / int64(m.weights); fair > 0 {
+		return fair
+	}
+	return 1
+}
+
+// reclaim evicts entries until g is within its maximum and the
+// groups within the manager's memory. It is called once g added an
+// entry, and only looks for a victim when the memory is full.
+func (m *MemoryManager) reclaim(g *Group) {
+	if max := g.share.MaxBytes; max > 0 {
+		for g.bytes() > max {
+			if !g.evictOne() {
+				break
+			}
+		}
+	}
+	if m.maxBytes <= 0 || m.total() <= m.maxBytes {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		var (
+			total    int64
+			victim   *Group
+			pressure float64
+		)
+		for _, mg := range m.groups {
+			bytes := mg.bytes()
+			total += bytes
+			if bytes <= mg.share.MinBytes {
+				continue
+			}
+			// the group using the most compared to its fair
+			// share gives memory back
+			p := float64(bytes) / float64(m.fairBytes(mg))
+			if victim == nil || p > pressure {
+				victim, pressure = mg, p
+			}
+		}
+		if total <= m.maxBytes {
+			return
+		}
+		if victim == nil {
+			// the minimums overcommit the memory
+			if g.bytes() == 0 {
+				return
+			}
+			victim = g
+		}
+		if !victim.evictOne() {
+			return
+		}
+	}
+}
+
+// Usage returns the memory used by each group of the manager, sorted
+// by group name.
+func (m *MemoryManager) Usage() []GroupUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	usage := make([]GroupUsage, 0, len(m.groups))
+	for name, g := range m.groups {
+		usage = append(usage, GroupUsage{
+			Group:     name,
+			Bytes:     g.bytes(),
+			FairBytes: m.fairBytes(g),
+			MinBytes:  g.share.MinBytes,
+			MaxBytes:  g.share.MaxBytes,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Group < usage[j].Group
+	})
+	return usage
+}
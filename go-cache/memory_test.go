@@ -0,0 +1,53 @@
+package gocache
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMemoryManager(t *testing.T) {
+	m := NewMemoryManager(1000)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte(strings.Repeat("v", 96)), nil
+	})
+	busy := NewGroup("busy", 0, getter, WithMemoryManager(m, Share{Weight: 4}))
+	idle := NewGroup("idle", 0, getter, WithMemoryManager(m, Share{Weight: 1, MinBytes: 300}))
+	capped := NewGroup("capped", 0, getter, WithMemoryManager(m, Share{Weight: 5, MaxBytes: 200}))
+
+	// entries take 100 bytes with their 4 bytes keys
+	get := func(g *Group, from, to int) {
+		for i := from; i < to; i++ {
+			if _, err := g.Get(fmt.Sprintf("k%03d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	get(busy, 0, 9)
+	if b := busy.bytes(); b != 900 {
+		t.Fatalf("expected the busy group to use the idle memory, got %d bytes", b)
+	}
+	get(idle, 0, 3)
+	if b := busy.bytes(); b != 700 {
+		t.Fatalf("expected the busy group to give memory back, got %d bytes", b)
+	}
+	get(capped, 0, 3)
+	if b := capped.bytes(); b != 200 {
+		t.Fatalf("expected the capped group to stay within its maximum, got %d bytes", b)
+	}
+	// idle is the most over its fair share, but at its minimum
+	get(busy, 9, 20)
+	if b := idle.bytes(); b != 300 {
+		t.Fatalf("expected the idle group to keep its minimum, got %d bytes", b)
+	}
+
+	want := []GroupUsage{
+		{Group: "busy", Bytes: 500, FairBytes: 400},
+		{Group: "capped", Bytes: 200, FairBytes: 500, MaxBytes: 200},
+		{Group: "idle", Bytes: 300, FairBytes: 100, MinBytes: 300},
+	}
+	if usage := m.Usage(); !reflect.DeepEqual(usage, want) {
+		t.Fatalf("expected usage %+v, got %+v", want, usage)
+	}
+}
@@ -0,0 +1,195 @@
+package gocache
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the buckets of the
+// peer request latency histograms.
+var latencyBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// peerMethods are the HTTP methods of the requests between peers.
+var peerMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+
+// histogram counts observations in latencyBuckets.
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64 // by bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func newLatencies() map[string]*histogram {
+	m := make(map[string]*histogram, len(peerMethods))
+	for _, method := range peerMethods {
+		m[method] = &histogram{counts: make([]uint64, len(latencyBuckets))}
+	}
+	return m
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := sort.SearchFloat64s(latencyBuckets, v); i < len(latencyBuckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+// MetricsHandler returns a handler rendering the statistics of every
+// group, and the latency of the requests of pools to their peers, in
+// the Prometheus text exposition format. It is meant to be mounted
+// next to the pools, e.g. on "/metrics".
+func MetricsHandler(pools ...*HTTPPool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		mw := &metricsWriter{w: bufio.NewWriter(w)}
+		writeGroupMetrics(mw)
+		writePeerMetrics(mw, pools)
+		mw.w.Flush()
+	})
+}
+
+// groupCounters are the counters of Stats rendered per group.
+var groupCounters = []struct {
+	name, help string
+	value      func(Stats) int64
+}{
+	{"gets_total", "Get requests, including from peers.", func(s Stats) int64 { return s.Gets }},
+	{"cache_hits_total", "Gets served by the main or hot cache.", func(s Stats) int64 { return s.CacheHits }},
+	{"negative_hits_total", "Gets of keys remembered as not found.", func(s Stats) int64 { return s.NegativeHits }},
+	{"loads_total", "Cache misses, loaded from a peer or locally.", func(s Stats) int64 { return s.Loads }},
+	{"loads_deduped_total", "Loads run after singleflight deduplication.", func(s Stats) int64 { return s.LoadsDeduped }},
+	{"loads_shared_total", "Loads served by a singleflight load in flight instead of their own.", func(s Stats) int64 { return s.LoadsShared }},
+	{"peer_loads_total", "Values loaded from peers.", func(s Stats) int64 { return s.PeerLoads }},
+	{"peer_errors_total", "Failed loads from peers.", func(s Stats) int64 { return s.PeerErrors }},
+	{"local_loads_total", "Values loaded by the Getter.", func(s Stats) int64 { return s.LocalLoads }},
+	{"local_load_errors_total", "Failed loads of the Getter.", func(s Stats) int64 { return s.LocalLoadErrs }},
+	{"refreshes_total", "Background reloads of expiring values.", func(s Stats) int64 { return s.Refreshes }},
+	{"stale_hits_total", "Expired values served while reloaded.", func(s Stats) int64 { return s.StaleHits }},
+	{"server_requests_total", "Gets received from peers.", func(s Stats) int64 { return s.ServerRequests }},
+}
+
+// cacheMetrics are the fields of CacheStats rendered per cache.
+var cacheMetrics = []struct {
+	name, typ, help string
+	value           func(CacheStats) int64
+}{
+	{"cache_bytes", "gauge", "Bytes held by the cache.", func(s CacheStats) int64 { return s.Bytes }},
+	{"cache_items", "gauge", "Entries held by the cache.", func(s CacheStats) int64 { return s.Items }},
+	{"cache_lookups_total", "counter", "Lookups of the cache.", func(s CacheStats) int64 { return s.Gets }},
+	{"cache_lookup_hits_total", "counter", "Lookups of the cache which hit.", func(s CacheStats) int64 { return s.Hits }},
+	{"cache_evictions_total", "counter", "Entries evicted from the cache to make room.", func(s CacheStats) int64 { return s.Evictions }},
+}
+
+func writeGroupMetrics(mw *metricsWriter) {
+	all := allGroups()
+	sort.Slice(all, func(i, j int) bool { return all[i].name < all[j].name })
+	stats := make([]Stats, len(all))
+	for i, g := range all {
+		stats[i] = g.Stats()
+	}
+
+	for _, c := range groupCounters {
+		mw.header(c.name, "counter", c.help)
+		for i, g := range all {
+			mw.sample(c.name, float64(c.value(stats[i])), "group", g.name)
+		}
+	}
+	for _, m := range cacheMetrics {
+		mw.header(m.name, m.typ, m.help)
+		for i, g := range all {
+			for _, c := range []struct {
+				name  string
+				stats CacheStats
+			}{{"main", stats[i].MainCache}, {"hot", stats[i].HotCache}, {"negative", stats[i].NegativeCache}} {
+				mw.sample(m.name, float64(m.value(c.stats)), "group", g.name, "cache", c.name)
+			}
+		}
+	}
+}
+
+func writePeerMetrics(mw *metricsWriter, pools []*HTTPPool) {
+	const name = "peer_request_duration_seconds"
+	mw.header(name, "histogram", "Latency of the requests to peers.")
+	for _, p := range pools {
+		p.mu.RLock()
+		peers := make([]string, 0, len(p.httpGetters))
+		for peer := range p.httpGetters {
+			peers = append(peers, peer)
+		}
+		sort.Strings(peers)
+		getters := make([]*httpGetter, len(peers))
+		for i, peer := range peers {
+			getters[i] = p.httpGetters[peer]
+		}
+		p.mu.RUnlock()
+
+		for i, h := range getters {
+			for _, method := range peerMethods {
+				hist := h.latency[method]
+				hist.mu.Lock()
+				var cumulative uint64
+				for j, le := range latencyBuckets {
+					cumulative += hist.counts[j]
+					mw.sample(name+"_bucket", float64(cumulative),
+						"peer", peers[i], "method", method, "le", formatFloat(le))
+				}
+				mw.sample(name+"_bucket", float64(hist.count), "peer", peers[i], "method", method, "le", "+Inf")
+				mw.sample(name+"_sum", hist.sum, "peer", peers[i], "method", method)
+				mw.sample(name+"_count", float64(hist.count), "peer", peers[i], "method", method)
+				hist.mu.Unlock()
+			}
+		}
+	}
+}
+
+// metricsWriter writes metrics in the Prometheus text format, their
+// names prefixed by "gocache_".
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+func (mw *metricsWriter) header(name, typ, help string) {
+	mw.w.WriteString("# HELP gocache_" + name + " " + help + "\n")
+	mw.w.WriteString("# TYPE gocache_" + name + " " + typ + "\n")
+}
+
+// sample writes a sample of name with the labels given as name and
+// value pairs.
+func (mw *metricsWriter) sample(name string, value float64, labels ...string) {
+	mw.w.WriteString("gocache_" + name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			mw.w.WriteByte('{')
+		} else {
+			mw.w.WriteByte(',')
+		}
+		mw.w.WriteString(labels[i] + `="` + labelEscaper.Replace(labels[i+1]) + `"`)
+	}
+	if len(labels) > 0 {
+		mw.w.WriteByte('}')
+	}
+	mw.w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// observeLatency records the duration of a request to the peer since
+// start.
+func (h *httpGetter) observeLatency(method string, start time.Time) {
+	if hist := h.latency[method]; hist != nil {
+		hist.observe(time.Since(start).Seconds())
+	}
+}
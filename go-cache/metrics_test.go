@@ -0,0 +1,58 @@
+package gocache
+
+import (
+	"bufio"
+	"context"
+	pb "go-cache/xmcachepb"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	g := NewGroup("metrics", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	g.Get("Tom")
+	g.Get("Tom")
+
+	srv := httptest.NewServer(NewHTTPPool("peer"))
+	defer srv.Close()
+	p := NewHTTPPool("http://self")
+	p.Set("http://self", srv.URL)
+	if err := p.httpGetters[srv.URL].Get(context.Background(), &pb.Request{Group: "metrics", Key: "Sam"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	MetricsHandler(p).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	for _, want := range []string{
+		"# TYPE gocache_gets_total counter\n",
+		`gocache_gets_total{group="metrics"} 3` + "\n",
+		`gocache_cache_hits_total{group="metrics"} 1` + "\n",
+		`gocache_loads_deduped_total{group="metrics"} 2` + "\n",
+		`gocache_loads_shared_total{group="metrics"} 0` + "\n",
+		`gocache_cache_items{group="metrics",cache="main"} 2` + "\n",
+		`gocache_cache_evictions_total{group="metrics",cache="hot"} 0` + "\n",
+		"# TYPE gocache_peer_request_duration_seconds histogram\n",
+		`gocache_peer_request_duration_seconds_bucket{peer="` + srv.URL + `",method="GET",le="+Inf"} 1` + "\n",
+		`gocache_peer_request_duration_seconds_count{peer="` + srv.URL + `",method="PUT"} 0` + "\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("expected the metrics to contain %q, got\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	var b strings.Builder
+	mw := &metricsWriter{w: bufio.NewWriter(&b)}
+	mw.sample("x", 1.5, "group", "a\"b\\c\nd")
+	mw.w.Flush()
+	if want := `gocache_x{group="a\"b\\c\nd"} 1.5` + "\n"; b.String() != want {
+		t.Fatalf("expected %q, got %q", want, b.String())
+	}
+}
@@ -0,0 +1,57 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// An OriginGetter is a Getter loading the values from an HTTP origin
+// server. The value of a key is the body of a GET of URL where "{key}"
+// is replaced by the escaped key. The origin answering 404 means the
+// key doesn't exist, the Getter returns ErrNotFound.
+type OriginGetter struct {
+	URL string // e.g. "http://origin.example.net/scores/{key}"
+	// Client is the client fetching the values, http.DefaultClient
+	// when nil.
+	Client *http.Client
+}
+
+// Get implements Getter interface function
+func (o *OriginGetter) Get(key string) ([]byte, error) {
+	return o.GetContext(context.Background(), key)
+}
+
+// GetContext implements ContextGetter interface function
+func (o *OriginGetter) GetContext(ctx context.Context, key string) ([]byte, error) {
+	u := strings.ReplaceAll(o.URL, "{key}", url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", key, ErrNotFound)
+	default:
+		return nil, fmt.Errorf("origin returned: %v", res.Status)
+	}
+	bytes, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading origin body: %v", err)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,38 @@
+package gocache
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOriginGetter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/scores/Tom":
+			w.Write([]byte("630"))
+		case "/scores/a%2Fb":
+			w.Write([]byte("escaped"))
+		case "/scores/broken":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	getter := &OriginGetter{URL: srv.URL + "/scores/{key}"}
+	if v, err := getter.Get("Tom"); err != nil || string(v) != "630" {
+		t.Fatalf("failed to get Tom from the origin: %s, %v", v, err)
+	}
+	if v, err := getter.Get("a/b"); err != nil || string(v) != "escaped" {
+		t.Fatalf("expected the key to be escaped: %s, %v", v, err)
+	}
+	if _, err := getter.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := getter.Get("broken"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected an origin error, got %v", err)
+	}
+}
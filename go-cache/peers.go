@@ -1,14 +1,123 @@
 package gocache
 
-import pb "go-cache/xmcachepb"
+import (
+	"context"
+	"errors"
+	pb "go-cache/xmcachepb"
+	"time"
+)
 
 // PeerPicker is the interface that must be implemented to locate
-// the peer that owns a specific key.
+// the peers that own a specific key.
 type PeerPicker interface {
-	PickPeer(key string) (peer PeerGetter, ok bool)
+	// PickPeer returns the owners of key other than this peer, in
+	// order of preference. primary is true when this peer is the
+	// preferred owner, the peers returned are then its replicas.
+	PickPeer(key string) (peers []PeerGetter, primary bool)
+	// GetAll returns all the peers in the pool except this one.
+	GetAll() []PeerGetter
+}
+
+// Placement is the interface that must be implemented to decide which
+// peer owns a key, such as consistenthash.Map, rendezvous.Map or
+// jump.Map. The pools call Get and GetN concurrently, so these must
+// be safe for concurrent use, while the calls changing the placement
+// are serialized with them.
+type Placement interface {
+	// Add adds peers to the placement.
+	Add(peers ...string)
+	// Remove removes peers from the placement, moving their keys.
+	Remove(peers ...string)
+	// Get returns the peer owning key, or "" without any peer.
+	Get(key string) string
+	// GetN returns up to n distinct peers owning key, Get's first.
+	GetN(key string, n int) []string
+}
+
+// A WeightedPlacement is a Placement whose peers may own unequal shares
+// of the keys, such as consistenthash.Map.
+type WeightedPlacement interface {
+	Placement
+	// AddWeighted adds peer, or changes its weight, so that it owns
+	// weight times the share of a peer added by Add.
+	AddWeighted(peer string, weight int)
+}
+
+// A LoadPlacement is a Placement balancing the keys by the load of the
+// peers when Bounded, such as consistenthash.Map created by NewBounded.
+// The pools count the requests in flight to a peer as its load.
+type LoadPlacement interface {
+	Placement
+	Bounded() bool
+	Inc(peer string)
+	Done(peer string)
 }
 
 // PeerGetter is the interface that must be implemented by a peer.
+// The calls give up once ctx is done.
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+	// Set stores a value in the peer's cache.
+	Set(ctx context.Context, in *pb.SetRequest) error
+	// Remove drops a key from the peer's cache.
+	Remove(ctx context.Context, in *pb.Request) error
+}
+
+// BatchPeerGetter is a PeerGetter which also gets several keys of a
+// group at once. Without it, GetMany gets the keys one at a time.
+type BatchPeerGetter interface {
+	PeerGetter
+	GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
+}
+
+// viewResponse returns the Response a peer sends for view.
+func viewResponse(view ByteView) *pb.Response {
+	res := &pb.Response{Value: view.ByteSlice(), Tags: view.tags}
+	if expire := view.Expire(); !expire.IsZero() {
+		res.Expire = expire.UnixNano()
+	}
+	return res
+}
+
+// errResponse returns the Response a peer sends when loading a key
+// failed, or nil when the failure must be sent as an error.
+func errResponse(err error) *pb.Response {
+	if errors.Is(err, ErrNotFound) {
+		return &pb.Response{Error: err.Error(), NotFound: true}
+	}
+	return nil
+}
+
+// responseErr returns the error carried by a Response, ErrNotFound
+// when the key doesn't exist.
+func responseErr(res *pb.Response) error {
+	switch {
+	case res.NotFound:
+		return ErrNotFound
+	case res.Error != "":
+		return errors.New(res.Error)
+	}
+	return nil
+}
+
+// responseView returns the value carried by a Response.
+func responseView(res *pb.Response) ByteView {
+	value := unixView(res.Value, res.Expire)
+	value.tags = res.Tags
+	return value
+}
+
+// setRequestView returns the value carried by a SetRequest.
+func setRequestView(in *pb.SetRequest) ByteView {
+	value := unixView(in.Value, in.Expire)
+	value.tags = in.Tags
+	return value
+}
+
+func unixView(b []byte, expire int64) ByteView {
+	value := ByteView{b: b}
+	if expire != 0 {
+		value.e = time.Unix(0, expire)
+	}
+	return value
 }
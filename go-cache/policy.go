@@ -0,0 +1,50 @@
+package gocache
+
+import (
+	"go-cache/arc"
+	"go-cache/lfu"
+	"go-cache/lru"
+	"go-cache/tinylfu"
+	"time"
+)
+
+// Policy is an eviction policy holding the entries of a cache. It
+// does not need to be safe for concurrent access.
+type Policy interface {
+	Add(key string, value lru.Value)
+	AddWithExpire(key string, value lru.Value, expire time.Time)
+	Get(key string) (value lru.Value, ok bool)
+	Remove(key string)
+	// RemoveOldest evicts the entry the policy values the least.
+	RemoveOldest()
+	RemoveExpired()
+	// Walk calls fn for every entry, from the one the policy values
+	// the least to the one it values the most.
+	Walk(fn func(key string, value lru.Value, expire time.Time))
+	Len() int
+	Bytes() int64
+}
+
+// A PolicyFunc creates an empty Policy holding at most maxBytes, zero
+// means no limit. onEvicted is called for every purged entry.
+type PolicyFunc func(maxBytes int64, onEvicted func(key string, value lru.Value)) Policy
+
+var (
+	// LRU evicts the least recently used entry, it is the default.
+	LRU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return lru.New(maxBytes, onEvicted)
+	}
+	// LFU evicts the least frequently used entry.
+	LFU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return lfu.New(maxBytes, onEvicted)
+	}
+	// ARC adapts between recency and frequency and resists scans.
+	ARC PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return arc.New(maxBytes, onEvicted)
+	}
+	// TinyLFU only admits new entries used more often than the ones
+	// they replace, it suits scan-heavy access patterns.
+	TinyLFU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) Policy {
+		return tinylfu.New(maxBytes, onEvicted)
+	}
+)
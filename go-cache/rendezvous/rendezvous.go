@@ -0,0 +1,117 @@
+package rendezvous
+
+// Hash maps bytes to uint64
+type Hash func(data []byte) uint64
+
+// Map places keys with rendezvous (highest random weight) hashing:
+// every node scores the key and the highest score wins. Only the keys
+// of a removed node move, and lookups don't allocate. Get and GetN may
+// be called concurrently, the other methods may not.
+type Map struct {
+	hash  Hash
+	nodes []node
+}
+
+type node struct {
+	key  string
+	hash uint64
+}
+
+func New(fn Hash) *Map {
+	return &Map{hash: fn}
+}
+
+// hashKey hashes key with the Hash of the map, or else with FNV-1a
+// without converting key to bytes.
+func (m *Map) hashKey(key string) uint64 {
+	if m.hash != nil {
+		return m.hash([]byte(key))
+	}
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// Add adds some keys to the hash.
+func (m *Map) Add(keys ...string) {
+	for _, key := range keys {
+		m.remove(key)
+		m.nodes = append(m.nodes, node{key: key, hash: m.hashKey(key)})
+	}
+}
+
+// Remove removes some keys from the hash.
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		m.remove(key)
+	}
+}
+
+func (m *Map) remove(key string) {
+	for i, n := range m.nodes {
+		if n.key == key {
+			m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Get gets the item with the highest score for the provided key.
+func (m *Map) Get(key string) string {
+	if len(m.nodes) == 0 {
+		return ""
+	}
+	h := m.hashKey(key)
+	best, max := 0, uint64(0)
+	for i, n := range m.nodes {
+		if score := mix(h ^ n.hash); i == 0 || score > max {
+			best, max = i, score
+		}
+	}
+	return m.nodes[best].key
+}
+
+// mix is the finalizer of splitmix64, it spreads the bits of x.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// GetN gets up to n items with the highest scores for the provided
+// key, the highest first.
+func (m *Map) GetN(key string, n int) []string {
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	if n < 1 {
+		return nil
+	}
+	h := m.hashKey(key)
+	scores := make([]uint64, n)
+	items := make([]string, 0, n)
+	for _, node := range m.nodes {
+		score := mix(h ^ node.hash)
+		// insertion into the items sorted by decreasing score
+		i := len(items)
+		for i > 0 && scores[i-1] < score {
+			i--
+		}
+		if i == n {
+			continue
+		}
+		if len(items) < n {
+			items = append(items, "")
+		}
+		copy(items[i+1:], items[i:len(items)-1])
+		copy(scores[i+1:], scores[i:len(items)-1])
+		items[i], scores[i] = node.key, score
+	}
+	return items
+}
@@ -0,0 +1,116 @@
+package rendezvous
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	m := New(nil)
+	if m.Get("key") != "" {
+		t.Fatalf("an empty map should not yield a node")
+	}
+	m.Add("a", "b", "c", "a")
+	if len(m.nodes) != 3 {
+		t.Fatalf("adding a node twice should be a no-op")
+	}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		if m.Get(key) != m.Get(key) || m.Get(key) == "" {
+			t.Fatalf("Asking for %s should always yield the same node", key)
+		}
+	}
+}
+
+func TestMovement(t *testing.T) {
+	m := New(nil)
+	m.Add("a", "b", "c", "d")
+
+	const n = 10000
+	before := make([]string, n)
+	for i := range before {
+		before[i] = m.Get("key" + strconv.Itoa(i))
+	}
+
+	m.Add("e")
+	moved := 0
+	for i, owner := range before {
+		if got := m.Get("key" + strconv.Itoa(i)); got != owner {
+			if got != "e" {
+				t.Fatalf("key%d moved from %s to %s instead of the new node", i, owner, got)
+			}
+			moved++
+		}
+	}
+	t.Logf("adding a 5th node moved %d of %d keys", moved, n)
+	if moved < n/10 || moved > n*3/10 {
+		t.Fatalf("expected about 1/5 of the keys to move, got %d", moved)
+	}
+
+	m.Remove("e")
+	for i, owner := range before {
+		if got := m.Get("key" + strconv.Itoa(i)); got != owner {
+			t.Fatalf("removing e should restore key%d to %s, got %s", i, owner, got)
+		}
+	}
+}
+
+func TestBalance(t *testing.T) {
+	m := New(nil)
+	for i := 0; i < 10; i++ {
+		m.Add("node" + strconv.Itoa(i))
+	}
+	const n = 100000
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		counts[m.Get("key"+strconv.Itoa(i))]++
+	}
+
+	mean := float64(n) / 10
+	var variance, max float64
+	for _, c := range counts {
+		d := float64(c) - mean
+		variance += d * d / 10
+		max = math.Max(max, math.Abs(d)/mean)
+	}
+	t.Logf("%d keys on 10 nodes: stddev %.2f%% of the mean, max deviation %.2f%%",
+		n, math.Sqrt(variance)/mean*100, max*100)
+	if max > 0.1 {
+		t.Fatalf("a node is %.2f%% away from the mean", max*100)
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	m := New(nil)
+	for i := 0; i < 10; i++ {
+		m.Add("node" + strconv.Itoa(i))
+	}
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get(keys[i%len(keys)])
+	}
+}
+
+func TestGetN(t *testing.T) {
+	m := New(nil)
+	if len(m.GetN("key", 2)) != 0 {
+		t.Fatalf("an empty map should not yield a node")
+	}
+	m.Add("a", "b", "c")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		items := m.GetN(key, 2)
+		if len(items) != 2 || items[0] != m.Get(key) || items[0] == items[1] {
+			t.Fatalf("expected %s to yield 2 distinct nodes, Get's first, got %v", key, items)
+		}
+	}
+	if len(m.GetN("key", 5)) != 3 {
+		t.Fatalf("GetN should yield at most every node")
+	}
+}
@@ -0,0 +1,477 @@
+package gocache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go-cache/consistenthash"
+	pb "go-cache/xmcachepb"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	rpcMethodGet        = "GroupCache.Get"
+	rpcMethodGetMany    = "GroupCache.GetMany"
+	rpcMethodSet        = "GroupCache.Set"
+	rpcMethodRemove     = "GroupCache.Remove"
+	rpcMethodInvalidate = "GroupCache.Invalidate"
+
+	defaultConnsPerPeer = 4
+	defaultDialTimeout  = 5 * time.Second
+	// defaultWriteTimeout bounds the writes of the calls without a
+	// deadline.
+	defaultWriteTimeout = 5 * time.Second
+	// maxFrameSize bounds the frames read from the network.
+	maxFrameSize = 64 << 20
+)
+
+var errConnClosed = errors.New("rpc: connection closed")
+
+// RPCPool implements PeerPicker for a pool of peers talking the
+// GroupCache service over persistent TCP connections. Each frame is
+// a protobuf message prefixed by its length as a 4 byte big endian
+// integer, and calls are multiplexed over a few connections per peer.
+//
+// The connections are plaintext and not authenticated, any client
+// reaching the pool may set and remove keys, so it is only meant for
+// trusted networks. Use HTTPPool with WithTLSConfig or WithHMAC
+// otherwise.
+type RPCPool struct {
+	// this peer's address, e.g. "10.0.0.1:8008"
+	self       string
+	mu         sync.Mutex // guards peers and rpcGetters
+	peers      *consistenthash.Map
+	rpcGetters map[string]*rpcGetter // keyed by e.g. "10.0.0.2:8008"
+}
+
+func NewRPCPool(self string) *RPCPool {
+	return &RPCPool{self: self}
+}
+
+// Set updates the pool's list of peers.
+func (p *RPCPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, getter := range p.rpcGetters {
+		getter.close()
+	}
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.rpcGetters = make(map[string]*rpcGetter, len(peers))
+	for _, peer := range peers {
+		p.rpcGetters[peer] = &rpcGetter{addr: peer}
+	}
+}
+
+// PickPeer picks the peer owning key
+func (p *RPCPool) PickPeer(key string) ([]PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, true
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		p.Log("Pick peer %s", peer)
+		return []PeerGetter{p.rpcGetters[peer]}, false
+	}
+	return nil, true
+}
+
+// GetAll returns all the peers in the pool except this one.
+func (p *RPCPool) GetAll() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var peers []PeerGetter
+	for peer, getter := range p.rpcGetters {
+		if peer != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
+
+func (p *RPCPool) Log(format string, v ...interface{}) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// ListenAndServe listens on addr and serves the peers connecting to it.
+func (p *RPCPool) ListenAndServe(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return p.Serve(lis)
+}
+
+// Serve accepts connections on lis and serves the calls made over
+// them, until lis is closed.
+func (p *RPCPool) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+func (p *RPCPool) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	var wmu sync.Mutex // serializes the responses
+	for {
+		req := &pb.RPCRequest{}
+		if err := readFrame(r, req); err != nil {
+			if err != io.EOF {
+				p.Log("rpc: reading request: %v", err)
+			}
+			return
+		}
+		go func() {
+			res := p.handle(req)
+			wmu.Lock()
+			defer wmu.Unlock()
+			if err := writeFrame(conn, res); err != nil {
+				p.Log("rpc: writing response: %v", err)
+			}
+		}()
+	}
+}
+
+// handle runs a call and returns its response frame.
+func (p *RPCPool) handle(req *pb.RPCRequest) *pb.RPCResponse {
+	ctx := context.Background()
+	if req.Deadline != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(0, req.Deadline))
+		defer cancel()
+	}
+	res := &pb.RPCResponse{Seq: req.Seq}
+	out, err := p.call(ctx, req.Method, req.Body)
+	if err == nil && out != nil {
+		res.Body, err = proto.Marshal(out)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+func (p *RPCPool) call(ctx context.Context, method string, body []byte) (proto.Message, error) {
+	p.Log("%s", method)
+	switch method {
+	case rpcMethodGet, rpcMethodRemove:
+		in := &pb.Request{}
+		if err := proto.Unmarshal(body, in); err != nil {
+			return nil, err
+		}
+		group := GetGroup(in.Group)
+		if group == nil {
+			return nil, fmt.Errorf("no such group: %s", in.Group)
+		}
+		if method == rpcMethodRemove {
+			group.removeLocally(in.Key)
+			return &pb.Response{}, nil
+		}
+		group.counters.ServerRequests.Add(1)
+		view, err := group.GetContext(ctx, in.Key)
+		if res := errResponse(err); res != nil {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return viewResponse(view), nil
+	case rpcMethodGetMany:
+		in := &pb.BatchRequest{}
+		if err := proto.Unmarshal(body, in); err != nil {
+			return nil, err
+		}
+		group := GetGroup(in.Group)
+		if group == nil {
+			return nil, fmt.Errorf("no such group: %s", in.Group)
+		}
+		group.counters.ServerRequests.Add(1)
+		values, errs := group.getMany(ctx, in.Keys)
+		return batchResponse(in.Keys, values, errs), nil
+	case rpcMethodSet:
+		in := &pb.SetRequest{}
+		if err := proto.Unmarshal(body, in); err != nil {
+			return nil, err
+		}
+		group := GetGroup(in.Group)
+		if group == nil {
+			return nil, fmt.Errorf("no such group: %s", in.Group)
+		}
+		group.setLocally(in.Key, setRequestView(in))
+		return &pb.Response{}, nil
+	case rpcMethodInvalidate:
+		in := &pb.InvalidateRequest{}
+		if err := proto.Unmarshal(body, in); err != nil {
+			return nil, err
+		}
+		if in.Tag == "" && in.Prefix == "" {
+			return nil, fmt.Errorf("tag or prefix required")
+		}
+		group := GetGroup(in.Group)
+		if group == nil {
+			return nil, fmt.Errorf("no such group: %s", in.Group)
+		}
+		group.invalidateLocally(in)
+		return &pb.Response{}, nil
+	default:
+		return nil, fmt.Errorf("rpc: unknown method %s", method)
+	}
+}
+
+// writeFrame writes m prefixed by its length.
+func writeFrame(w io.Writer, m proto.Message) error {
+	body, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(buf, uint32(len(body)))
+	copy(buf[4:], body)
+	_, err = w.Write(buf)
+	return err
+}
+
+// readFrame reads a length prefixed frame into m.
+func readFrame(r io.Reader, m proto.Message) error {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n > maxFrameSize {
+		return fmt.Errorf("rpc: frame of %d bytes is too large", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return err
+	}
+	return proto.Unmarshal(body, m)
+}
+
+// rpcGetter is a PeerGetter keeping a pool of connections to a peer,
+// picked in turn for each call.
+type rpcGetter struct {
+	addr  string
+	mu    sync.Mutex // guards conns and next
+	conns [defaultConnsPerPeer]*rpcConn
+	next  int
+}
+
+// conn returns the next connection of the pool, dialing it if it is
+// missing or broken. The dial doesn't hold the lock, so that the
+// callers using the other connections don't wait for it.
+func (g *rpcGetter) conn(ctx context.Context) (*rpcConn, error) {
+	g.mu.Lock()
+	g.next = (g.next + 1) % len(g.conns)
+	i := g.next
+	c := g.conns[i]
+	g.mu.Unlock()
+	if c != nil && !c.broken() {
+		return c, nil
+	}
+
+	c, err := dialRPC(ctx, g.addr)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// another caller may have dialed the slot meanwhile
+	if old := g.conns[i]; old != nil && !old.broken() {
+		c.close(errConnClosed)
+		return old, nil
+	}
+	g.conns[i] = c
+	return c, nil
+}
+
+func (g *rpcGetter) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, c := range g.conns {
+		if c != nil {
+			c.close(errConnClosed)
+			g.conns[i] = nil
+		}
+	}
+}
+
+func (g *rpcGetter) call(ctx context.Context, method string, in, out proto.Message) error {
+	c, err := g.conn(ctx)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, method, in, out)
+}
+
+func (g *rpcGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	if err := g.call(ctx, rpcMethodGet, in, out); err != nil {
+		return err
+	}
+	return responseErr(out)
+}
+
+func (g *rpcGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	return g.call(ctx, rpcMethodGetMany, in, out)
+}
+
+func (g *rpcGetter) Set(ctx context.Context, in *pb.SetRequest) error {
+	return g.call(ctx, rpcMethodSet, in, nil)
+}
+
+func (g *rpcGetter) Remove(ctx context.Context, in *pb.Request) error {
+	return g.call(ctx, rpcMethodRemove, in, nil)
+}
+
+func (g *rpcGetter) Invalidate(ctx context.Context, in *pb.InvalidateRequest) error {
+	return g.call(ctx, rpcMethodInvalidate, in, nil)
+}
+
+// rpcConn multiplexes calls over a connection, matching responses to
+// the pending calls by sequence number.
+type rpcConn struct {
+	conn    net.Conn
+	wlock   chan struct{} // held to write a request, serializing them
+	mu      sync.Mutex    // guards seq, pending and err
+	seq     uint64
+	pending map[uint64]chan *pb.RPCResponse
+	err     error // set once the connection is broken
+}
+
+func dialRPC(ctx context.Context, addr string) (*rpcConn, error) {
+	d := net.Dialer{Timeout: defaultDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &rpcConn{
+		conn:    conn,
+		wlock:   make(chan struct{}, 1),
+		pending: make(map[uint64]chan *pb.RPCResponse),
+	}
+	go c.receive()
+	return c, nil
+}
+
+// forget drops the pending call seq, whose caller gave up.
+func (c *rpcConn) forget(seq uint64) {
+	c.mu.Lock()
+	delete(c.pending, seq)
+	c.mu.Unlock()
+}
+
+func (c *rpcConn) broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err != nil
+}
+
+// close breaks the connection and fails all the pending calls.
+func (c *rpcConn) close(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	c.conn.Close()
+	for seq, ch := range c.pending {
+		delete(c.pending, seq)
+		close(ch)
+	}
+}
+
+func (c *rpcConn) receive() {
+	r := bufio.NewReader(c.conn)
+	for {
+		res := &pb.RPCResponse{}
+		if err := readFrame(r, res); err != nil {
+			c.close(err)
+			return
+		}
+		c.mu.Lock()
+		ch := c.pending[res.Seq]
+		delete(c.pending, res.Seq)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- res
+		}
+	}
+}
+
+func (c *rpcConn) call(ctx context.Context, method string, in, out proto.Message) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	ch := make(chan *pb.RPCResponse, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.seq++
+	seq := c.seq
+	c.pending[seq] = ch
+	c.mu.Unlock()
+
+	req := &pb.RPCRequest{Seq: seq, Method: method, Body: body}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Deadline = deadline.UnixNano()
+	}
+	// a peer which stops reading must not hold the callers past
+	// their ctx, neither while writing nor waiting to write
+	select {
+	case c.wlock <- struct{}{}:
+	case <-ctx.Done():
+		c.forget(seq)
+		return ctx.Err()
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if !hasDeadline {
+		deadline = time.Now().Add(defaultWriteTimeout)
+	}
+	c.conn.SetWriteDeadline(deadline)
+	err = writeFrame(c.conn, req)
+	<-c.wlock
+	if err != nil {
+		// the frame may be partly written
+		c.close(err)
+		return err
+	}
+
+	var res *pb.RPCResponse
+	var ok bool
+	select {
+	case res, ok = <-ch:
+	case <-ctx.Done():
+		c.forget(seq)
+		return ctx.Err()
+	}
+	if !ok {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	}
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+	if out != nil {
+		return proto.Unmarshal(res.Body, out)
+	}
+	return nil
+}
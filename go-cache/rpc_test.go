@@ -0,0 +1,206 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	pb "go-cache/xmcachepb"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startRPCPool(t *testing.T) (string, func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewRPCPool(lis.Addr().String())
+	go pool.Serve(lis)
+	return lis.Addr().String(), func() { lis.Close() }
+}
+
+func TestRPCGetter(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	NewGroup("rpc", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "missing" {
+				return nil, fmt.Errorf("%s not exist", key)
+			}
+			return []byte(key), nil
+		}), WithTTL(time.Until(expire)))
+	addr, stop := startRPCPool(t)
+	defer stop()
+
+	getter := &rpcGetter{addr: addr}
+	defer getter.close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("key%d", i)
+			res := &pb.Response{}
+			if err := getter.Get(context.Background(), &pb.Request{Group: "rpc", Key: key}, res); err != nil {
+				t.Error(err)
+				return
+			}
+			if string(res.Value) != key || res.Expire < expire.UnixNano() {
+				t.Errorf("unexpected response %v for %s", res, key)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	err := getter.Get(context.Background(), &pb.Request{Group: "rpc", Key: "missing"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "missing not exist") {
+		t.Fatalf("expected the loader error, got %v", err)
+	}
+	err = getter.Get(context.Background(), &pb.Request{Group: "no-such-group", Key: "k"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "no such group") {
+		t.Fatalf("expected an unknown group error, got %v", err)
+	}
+
+	if err := getter.Set(context.Background(), &pb.SetRequest{Group: "rpc", Key: "missing", Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	res := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "rpc", Key: "missing"}, res); err != nil || string(res.Value) != "v" {
+		t.Fatalf("Set should store the value, got %v %v", res, err)
+	}
+	if err := getter.Remove(context.Background(), &pb.Request{Group: "rpc", Key: "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "rpc", Key: "missing"}, &pb.Response{}); err == nil {
+		t.Fatalf("Remove should drop the value")
+	}
+}
+
+func TestRPCGetterRedial(t *testing.T) {
+	NewGroup("rpc-redial", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	addr, stop := startRPCPool(t)
+	defer stop()
+
+	getter := &rpcGetter{addr: addr}
+	defer getter.close()
+	for i := 0; i < defaultConnsPerPeer; i++ {
+		if err := getter.Get(context.Background(), &pb.Request{Group: "rpc-redial", Key: "k"}, &pb.Response{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// break every pooled connection, the next calls dial again
+	for _, c := range getter.conns {
+		c.conn.Close()
+	}
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < defaultConnsPerPeer; i++ {
+		if err := getter.Get(context.Background(), &pb.Request{Group: "rpc-redial", Key: "k"}, &pb.Response{}); err != nil {
+			t.Fatalf("expected a new connection, got %v", err)
+		}
+	}
+}
+
+func TestRPCGetMany(t *testing.T) {
+	NewGroup("rpc-batch", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	addr, stop := startRPCPool(t)
+	defer stop()
+
+	getter := &rpcGetter{addr: addr}
+	defer getter.close()
+	res := &pb.BatchResponse{}
+	in := &pb.BatchRequest{Group: "rpc-batch", Keys: []string{"k1", "", "k2"}}
+	if err := getter.GetMany(context.Background(), in, res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Values) != 3 || string(res.Values[0].Value) != "k1" || res.Values[1].Error == "" || string(res.Values[2].Value) != "k2" {
+		t.Fatalf("unexpected batch response %v", res)
+	}
+}
+
+func TestRPCPoolPickPeer(t *testing.T) {
+	pool := NewRPCPool("self:1")
+	pool.Set("self:1", "peer:2")
+	if len(pool.GetAll()) != 1 {
+		t.Fatalf("GetAll should skip this peer")
+	}
+	var _ PeerPicker = pool
+	var _ BatchPeerGetter = &rpcGetter{}
+}
+
+func TestRPCGetterStuckPeer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	// the peer accepts the connections but never reads them
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	getter := &rpcGetter{addr: lis.Addr().String()}
+	defer getter.close()
+	value := make([]byte, 8<<20)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 2*defaultConnsPerPeer; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if err := getter.Set(ctx, &pb.SetRequest{Group: "g", Key: "k", Value: value}); err == nil {
+				t.Errorf("expected the call to a stuck peer to fail")
+			}
+		}()
+	}
+	wg.Wait()
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("expected the callers to give up with their ctx, took %v", d)
+	}
+}
+
+func TestRPCInvalidate(t *testing.T) {
+	g := NewGroup("rpc-invalidate", 2<<10, userGetter)
+	g.Get("user:1:a")
+	g.Get("user:2:a")
+	addr, stop := startRPCPool(t)
+	defer stop()
+
+	getter := &rpcGetter{addr: addr}
+	defer getter.close()
+	if err := getter.Invalidate(context.Background(), &pb.InvalidateRequest{Group: "rpc-invalidate", Tag: "user:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("user:1:a"); ok {
+		t.Fatalf("expected the tag to be invalidated")
+	}
+	if _, ok := g.mainCache.get("user:2:a"); !ok {
+		t.Fatalf("expected the other tags to stay")
+	}
+
+	// the peers which can't invalidate are reported
+	g.RegisterPeers(fakePeers{&fakePeer{values: map[string][]byte{}}})
+	if err := g.InvalidatePrefix("user:"); err != errNotInvalidator {
+		t.Fatalf("expected errNotInvalidator, got %v", err)
+	}
+}
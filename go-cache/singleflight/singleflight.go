@@ -1,39 +1,294 @@
 package singleflight
 
-import "sync"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+var (
+	// errGoexit is the error of a call whose fn called runtime.Goexit.
+	errGoexit = errors.New("singleflight: fn called runtime.Goexit")
+	// errNoResult is the error of a key DoManyContext's fn left out.
+	errNoResult = errors.New("singleflight: fn returned no result")
+)
+
+// A panicError is the error of a call whose fn panicked, it carries
+// the value given to panic and the stack of fn.
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *panicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.value, p.stack)
+}
+
+func newPanicError(v interface{}) error {
+	stack := debug.Stack()
+	// drop the first line "goroutine N [status]:", it doesn't
+	// match the goroutine panicking again
+	if line := bytes.IndexByte(stack, '\n'); line >= 0 {
+		stack = stack[line+1:]
+	}
+	return &panicError{value: v, stack: stack}
+}
 
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done  chan struct{} // closed once fn returned
+	val   interface{}
+	err   error
+	dups  int // number of callers sharing the call
+	chans []chan<- Result
+}
+
+// result returns the result of the call once done, panicking or
+// calling runtime.Goexit when fn did.
+func (c *call) result() (interface{}, error, bool) {
+	if e, ok := c.err.(*panicError); ok {
+		panic(e)
+	}
+	if c.err == errGoexit {
+		runtime.Goexit()
+	}
+	return c.val, c.err, c.dups > 0
+}
+
+// Result holds the results of Do, so they can be passed on a channel.
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool // whether Val was given to several callers
 }
 
 type Group struct {
-	mu sync.Mutex // protects m
-	m  map[string]*call
+	mu     sync.Mutex // protects m and shared
+	m      map[string]*call
+	shared int64 // number of calls which joined one in flight
+}
+
+// Shared returns the number of calls which shared the result of a
+// call in flight instead of running fn.
+func (g *Group) Shared() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.shared
+}
+
+// acquire returns the call in flight for key, or a new one when leader
+// is true, in which case the caller must run it.
+func (g *Group) acquire(key string) (c *call, leader bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.shared++
+		return c, false
+	}
+	c = &call{done: make(chan struct{})}
+	g.m[key] = c
+	return c, true
+}
+
+// doCall runs fn for c, recording a panic or runtime.Goexit of fn as
+// the call's error so that every caller gets it.
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	normalReturn := false
+	defer func() {
+		// fn neither returned nor panicked
+		if !normalReturn && c.err == nil {
+			c.err = errGoexit
+		}
+		g.finish(c, key)
+	}()
+
+	func() {
+		defer func() {
+			if !normalReturn {
+				if r := recover(); r != nil {
+					c.err = newPanicError(r)
+				}
+			}
+		}()
+		c.val, c.err = fn()
+		normalReturn = true
+	}()
+}
+
+// finish completes c, removing it from the calls in flight and sending
+// its result to the callers of DoChan.
+func (g *Group) finish(c *call, key string) {
+	g.mu.Lock()
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+	chans := c.chans
+	g.mu.Unlock()
+	close(c.done)
+
+	if e, ok := c.err.(*panicError); ok {
+		// A panic can't be sent on a channel, crash rather
+		// than leaving the receivers waiting forever.
+		if len(chans) > 0 {
+			panic(e)
+		}
+		return
+	}
+	for _, ch := range chans {
+		ch <- Result{c.val, c.err, c.dups > 0}
+	}
 }
 
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+// Do executes and returns the results of fn, making sure that only one
+// execution is in flight for a given key at a time. The callers asking
+// for key meanwhile wait for it and share its results, shared reports
+// whether this happened. A panic or runtime.Goexit of fn happens again
+// in every caller.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	c, leader := g.acquire(key)
+	if leader {
+		g.doCall(c, key, fn)
+	} else {
+		<-c.done
+	}
+	return c.result()
+}
+
+// DoChan is like Do, but returns a channel receiving the results once
+// they are ready. fn runs in its own goroutine, when it panics the
+// program crashes since the panic can't be passed on the channel.
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call)
 	}
 	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.shared++
+		c.chans = append(c.chans, ch)
 		g.mu.Unlock()
-		c.wg.Wait()
-		return c.val, c.err
+		return ch
 	}
-	c := new(call)
-	c.wg.Add(1)
+	c := &call{done: make(chan struct{}), chans: []chan<- Result{ch}}
 	g.m[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = fn()
-	c.wg.Done()
+	go g.doCall(c, key, fn)
+	return ch
+}
+
+// DoContext is like Do, but each caller stops waiting once its ctx is
+// done. fn runs in its own goroutine and is not interrupted, so the
+// other callers still get its result.
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	c, leader := g.acquire(key)
+	if leader {
+		go g.doCall(c, key, fn)
+	}
+	select {
+	case <-c.done:
+		return c.result()
+	case <-ctx.Done():
+		return nil, ctx.Err(), false
+	}
+}
+
+// DoManyContext is like DoContext for several keys at once. fn runs in
+// its own goroutine with the keys no call is in flight for, and
+// returns their results, while the other keys share the calls in
+// flight. The results of the keys are returned once all of them are
+// ready, or ctx is done.
+func (g *Group) DoManyContext(ctx context.Context, keys []string, fn func(keys []string) map[string]Result) map[string]Result {
+	calls := make(map[string]*call, len(keys))
+	var led []string
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	for _, key := range keys {
+		if _, ok := calls[key]; ok {
+			continue
+		}
+		if c, ok := g.m[key]; ok {
+			c.dups++
+			g.shared++
+			calls[key] = c
+			continue
+		}
+		c := &call{done: make(chan struct{})}
+		g.m[key] = c
+		calls[key] = c
+		led = append(led, key)
+	}
+	g.mu.Unlock()
+	if len(led) > 0 {
+		go g.doMany(led, calls, fn)
+	}
+
+	results := make(map[string]Result, len(calls))
+	for key, c := range calls {
+		select {
+		case <-c.done:
+			v, err, shared := c.result()
+			results[key] = Result{v, err, shared}
+		case <-ctx.Done():
+			results[key] = Result{Err: ctx.Err()}
+		}
+	}
+	return results
+}
+
+// doMany runs fn for the calls of keys like doCall, a panic or
+// runtime.Goexit of fn becoming the error of every call.
+func (g *Group) doMany(keys []string, calls map[string]*call, fn func([]string) map[string]Result) {
+	var (
+		results      map[string]Result
+		failure      error
+		normalReturn bool
+	)
+	defer func() {
+		if !normalReturn && failure == nil {
+			failure = errGoexit
+		}
+		for _, key := range keys {
+			c := calls[key]
+			switch res, ok := results[key]; {
+			case failure != nil:
+				c.err = failure
+			case ok:
+				c.val, c.err = res.Val, res.Err
+			default:
+				c.err = errNoResult
+			}
+			g.finish(c, key)
+		}
+	}()
 
+	func() {
+		defer func() {
+			if !normalReturn {
+				if r := recover(); r != nil {
+					failure = newPanicError(r)
+				}
+			}
+		}()
+		results = fn(keys)
+		normalReturn = true
+	}()
+}
+
+// Forget tells the group to forget about key, the next calls for it
+// run fn instead of waiting for the call in flight.
+func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
-
-	return c.val, c.err
 }
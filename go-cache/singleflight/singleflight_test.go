@@ -0,0 +1,271 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil || shared {
+		t.Fatalf("Do = %v, %v, %v", v, err, shared)
+	}
+
+	someErr := errors.New("some error")
+	if _, err, _ := g.Do("key", func() (interface{}, error) {
+		return nil, someErr
+	}); err != someErr {
+		t.Fatalf("Do error = %v; want someErr", err)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	var shared int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, s := g.Do("key", fn)
+			if v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	waitDups(&g, "key", n-1)
+	close(release)
+	wg.Wait()
+	if calls != 1 || shared != n {
+		t.Fatalf("expected 1 shared call, got %d calls and %d shared results", calls, shared)
+	}
+	if s := g.Shared(); s != n-1 {
+		t.Fatalf("expected %d calls to share the call in flight, got %d", n-1, s)
+	}
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+	ch2 := g.DoChan("key", func() (interface{}, error) {
+		t.Errorf("fn should not run while a call is in flight")
+		return nil, nil
+	})
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		res := <-ch
+		if res.Val != "bar" || res.Err != nil || !res.Shared {
+			t.Fatalf("DoChan = %+v", res)
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	first := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return 1, nil
+	})
+
+	g.Forget("key")
+	second := g.DoChan("key", func() (interface{}, error) {
+		return 2, nil
+	})
+	if res := <-second; res.Val != 2 {
+		t.Fatalf("expected a forgotten key to run fn again, got %v", res.Val)
+	}
+	close(release)
+	if res := <-first; res.Val != 1 {
+		t.Fatalf("expected the forgotten call to complete, got %v", res.Val)
+	}
+
+	if v, _, _ := g.Do("key", func() (interface{}, error) {
+		return 3, nil
+	}); v != 3 {
+		t.Fatalf("expected the completed calls to be gone, got %v", v)
+	}
+}
+
+func TestPanicDo(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("invalid memory address or nil pointer dereference")
+	}
+
+	const n = 5
+	var wg sync.WaitGroup
+	var panics int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if err := recover(); err != nil {
+					atomic.AddInt32(&panics, 1)
+				}
+			}()
+			g.Do("key", fn)
+		}()
+	}
+	waitDups(&g, "key", n-1)
+	close(release)
+	wg.Wait()
+	if panics != n {
+		t.Fatalf("expected %d callers to panic, got %d", n, panics)
+	}
+	if _, ok := g.m["key"]; ok {
+		t.Fatalf("a panicking call should not stay in flight")
+	}
+}
+
+func TestGoexitDo(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		runtime.Goexit()
+		return nil, nil
+	}
+
+	const n = 5
+	var wg sync.WaitGroup
+	var returned int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Do("key", fn)
+			atomic.AddInt32(&returned, 1)
+		}()
+	}
+	waitDups(&g, "key", n-1)
+	close(release)
+	wg.Wait()
+	if returned != 0 {
+		t.Fatalf("expected every caller to exit, %d returned", returned)
+	}
+}
+
+func TestPanicDoContext(t *testing.T) {
+	var g Group
+	defer func() {
+		if err := recover(); err == nil {
+			t.Fatalf("expected the panic to reach the caller")
+		}
+		if _, ok := g.m["key"]; ok {
+			t.Fatalf("a panicking call should not stay in flight")
+		}
+	}()
+	g.DoContext(context.Background(), "key", func() (interface{}, error) {
+		panic("boom")
+	})
+}
+
+func TestGoexitDoChan(t *testing.T) {
+	var g Group
+	res := <-g.DoChan("key", func() (interface{}, error) {
+		runtime.Goexit()
+		return nil, nil
+	})
+	if res.Err != errGoexit {
+		t.Fatalf("expected errGoexit, got %v", res.Err)
+	}
+}
+
+func TestDoContextCancel(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	}
+	ch := g.DoChan("key", fn)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err, _ := g.DoContext(ctx, "key", fn); err != context.Canceled {
+		t.Fatalf("expected the waiter to give up, got %v", err)
+	}
+	close(release)
+	if res := <-ch; res.Val != "bar" {
+		t.Fatalf("expected the call to complete, got %v", res.Val)
+	}
+}
+
+func TestDoManyContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch := g.DoChan("a", func() (interface{}, error) {
+		<-release
+		return "a1", nil
+	})
+
+	done := make(chan map[string]Result)
+	go func() {
+		done <- g.DoManyContext(context.Background(), []string{"a", "b", "b", "c"}, func(keys []string) map[string]Result {
+			if len(keys) != 2 || keys[0] != "b" || keys[1] != "c" {
+				t.Errorf("expected fn to get the keys not in flight, got %v", keys)
+			}
+			return map[string]Result{"b": {Val: "b2"}}
+		})
+	}()
+	waitDups(&g, "a", 1)
+	close(release)
+	results := <-done
+	if res := results["a"]; res.Val != "a1" || !res.Shared {
+		t.Fatalf("expected a to share the call in flight, got %+v", res)
+	}
+	if res := results["b"]; res.Val != "b2" || res.Err != nil {
+		t.Fatalf("expected b to be loaded by fn, got %+v", res)
+	}
+	if res := results["c"]; res.Err != errNoResult {
+		t.Fatalf("expected errNoResult, got %+v", res)
+	}
+	if res := <-ch; res.Val != "a1" {
+		t.Fatalf("DoChan = %+v", res)
+	}
+	if len(g.m) != 0 {
+		t.Fatalf("expected no call left in flight")
+	}
+}
+
+// waitDups waits for n callers to join the call in flight for key.
+func waitDups(g *Group, key string, n int) {
+	for {
+		g.mu.Lock()
+		c := g.m[key]
+		joined := c != nil && c.dups == n
+		g.mu.Unlock()
+		if joined {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,200 @@
+package gocache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A snapshot starts with snapshotMagic and the format's version,
+// followed by the number of entries and the entries themselves, from
+// the least recently used to the most. Each entry is made of the
+// uvarint length of its key, the key, the uvarint length of its
+// value, the value, the varint expiry in Unix nanoseconds, zero when
+// the value never expires, and since version 2 the uvarint number of
+// its tags followed by the length and bytes of each tag.
+const (
+	snapshotMagic   = "XMCS"
+	snapshotVersion = 2
+)
+
+var errSnapshotFormat = errors.New("gocache: not a snapshot")
+
+// WithSnapshotFile restores the group's main cache from the snapshot
+// in path when it is created, and writes a new one there on Close.
+func WithSnapshotFile(path string) GroupOption {
+	return func(g *Group) {
+		g.snapshotFile = path
+	}
+}
+
+// Snapshot writes the entries of the group's main cache to w, with
+// their recency and expiry, so that Restore can warm up a new group.
+func (g *Group) Snapshot(w io.Writer) error {
+	type item struct {
+		key   string
+		value ByteView
+	}
+	var items []item
+	g.mainCache.walk(func(key string, value ByteView) {
+		items = append(items, item{key, value})
+	})
+
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+	writeUvarint := func(x uint64) {
+		bw.Write(buf[:binary.PutUvarint(buf, x)])
+	}
+	bw.WriteString(snapshotMagic)
+	bw.WriteByte(snapshotVersion)
+	writeUvarint(uint64(len(items)))
+	for _, it := range items {
+		writeUvarint(uint64(len(it.key)))
+		bw.WriteString(it.key)
+		writeUvarint(uint64(len(it.value.b)))
+		bw.Write(it.value.b)
+		var expire int64
+		if e := it.value.Expire(); !e.IsZero() {
+			expire = e.UnixNano()
+		}
+		bw.Write(buf[:binary.PutVarint(buf, expire)])
+		writeUvarint(uint64(len(it.value.tags)))
+		for _, tag := range it.value.tags {
+			writeUvarint(uint64(len(tag)))
+			bw.WriteString(tag)
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore adds the entries of a snapshot written by Snapshot to the
+// group's main cache, skipping the ones which expired meanwhile.
+func (g *Group) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(snapshotMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return errSnapshotFormat
+	}
+	if !bytes.Equal(header[:len(snapshotMagic)], []byte(snapshotMagic)) {
+		return errSnapshotFormat
+	}
+	version := header[len(snapshotMagic)]
+	if version < 1 || version > snapshotVersion {
+		return fmt.Errorf("gocache: unsupported snapshot version %d", version)
+	}
+
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		if n > maxFrameSize {
+			return nil, fmt.Errorf("gocache: snapshot entry of %d bytes", n)
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(br, b)
+		return b, err
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := uint64(0); i < n; i++ {
+		key, err := readBytes()
+		if err != nil {
+			return err
+		}
+		value, err := readBytes()
+		if err != nil {
+			return err
+		}
+		expire, err := binary.ReadVarint(br)
+		if err != nil {
+			return err
+		}
+		view := unixView(value, expire)
+		if version >= 2 {
+			n, err := binary.ReadUvarint(br)
+			if err != nil {
+				return err
+			}
+			if n > maxFrameSize {
+				return fmt.Errorf("gocache: snapshot entry of %d tags", n)
+			}
+			for j := uint64(0); j < n; j++ {
+				tag, err := readBytes()
+				if err != nil {
+					return err
+				}
+				view.tags = append(view.tags, string(tag))
+			}
+		}
+		if e := view.Expire(); !e.IsZero() && !now.Before(e) {
+			continue
+		}
+		g.popluateCache(string(key), view, g.mainCache)
+	}
+	return nil
+}
+
+// restoreFile restores the group from the snapshot file, if any.
+func (g *Group) restoreFile() {
+	f, err := os.Open(g.snapshotFile)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Println("[XmCache] Failed to restore snapshot", err)
+		return
+	}
+	defer f.Close()
+	if err := g.Restore(f); err != nil {
+		log.Println("[XmCache] Failed to restore snapshot", err)
+	}
+}
+
+// writeSnapshotFile writes the group's snapshot to a temporary file and
+// renames it, so that a failure never leaves a partial snapshot.
+func (g *Group) writeSnapshotFile() error {
+	f, err := os.CreateTemp(filepath.Dir(g.snapshotFile), filepath.Base(g.snapshotFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := g.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), g.snapshotFile)
+}
+
+// Close writes the pending writes of WithWriteBehind and the group's
+// snapshot file set by WithSnapshotFile, it is meant to be called on
+// graceful shutdown. The values set or loaded after Close are lost,
+// and so are the writes failing during Close.
+func (g *Group) Close() error {
+	var err error
+	if w := g.writer; w != nil {
+		w.closeOnce.Do(func() { close(w.done) })
+		err = g.Flush(context.Background())
+	}
+	if g.snapshotFile == "" {
+		return err
+	}
+	if e := g.writeSnapshotFile(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package gocache
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	getter := GetterWithTTLFunc(func(key string) ([]byte, time.Duration, error) {
+		if key == "short" {
+			return []byte(key), 10 * time.Millisecond, nil
+		}
+		return []byte(key), time.Hour, nil
+	})
+	for name, policy := range map[string]PolicyFunc{"lru": LRU, "lfu": LFU, "arc": ARC, "tinylfu": TinyLFU} {
+		xm := NewGroup("snapshot-"+name, 0, getter, WithPolicy(policy))
+		for i := 0; i < 10; i++ {
+			xm.Get("key" + strconv.Itoa(i))
+		}
+		xm.Get("short")
+
+		var buf bytes.Buffer
+		if err := xm.Snapshot(&buf); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		restored := NewGroup("snapshot-restored-"+name, 0, GetterFunc(
+			func(key string) ([]byte, error) {
+				return nil, fmt.Errorf("%s not restored", key)
+			}), WithPolicy(policy))
+		if err := restored.Restore(&buf); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 10; i++ {
+			view, ok := restored.mainCache.get("key" + strconv.Itoa(i))
+			if !ok || view.String() != "key"+strconv.Itoa(i) || view.Expire().IsZero() {
+				t.Fatalf("%s: expected key%d to be restored with its expiry", name, i)
+			}
+		}
+		if _, ok := restored.mainCache.get("short"); ok {
+			t.Fatalf("%s: expired entries should not be restored", name)
+		}
+	}
+}
+
+func TestSnapshotRecency(t *testing.T) {
+	xm := NewGroup("snapshot-recency", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	xm.Get("k1")
+	xm.Get("k2")
+	xm.Get("k3")
+	xm.Get("k1")
+
+	var buf bytes.Buffer
+	if err := xm.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored := NewGroup("snapshot-recency-restored", 0, xm.getter)
+	if err := restored.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	restored.mainCache.removeOldest()
+	if _, ok := restored.mainCache.get("k2"); ok {
+		t.Fatalf("expected k2 to stay the least recently used")
+	}
+}
+
+func TestRestoreFormat(t *testing.T) {
+	xm := NewGroup("snapshot-format", 0, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	if err := xm.Restore(bytes.NewBufferString("not a snapshot")); err != errSnapshotFormat {
+		t.Fatalf("expected errSnapshotFormat, got %v", err)
+	}
+	if err := xm.Restore(bytes.NewBufferString(snapshotMagic + "\x02")); err == nil {
+		t.Fatalf("expected an unknown version to be rejected")
+	}
+	if err := xm.Restore(bytes.NewBufferString(snapshotMagic + "\x01\x01\x03ke")); err == nil {
+		t.Fatalf("expected a truncated snapshot to be rejected")
+	}
+}
+
+func TestWithSnapshotFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scores.snapshot")
+	var loads int
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	})
+	xm := NewGroup("snapshot-file", 0, getter, WithSnapshotFile(path))
+	xm.Get("Tom")
+	if err := xm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	xm = NewGroup("snapshot-file", 0, getter, WithSnapshotFile(path))
+	if view, err := xm.Get("Tom"); err != nil || view.String() != "Tom" || loads != 1 {
+		t.Fatalf("expected Tom to be restored from the snapshot file")
+	}
+}
@@ -0,0 +1,88 @@
+package gocache
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// An AtomicInt is an int64 to be accessed atomically.
+type AtomicInt int64
+
+// Add atomically adds n to i.
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+// Get atomically gets the value of i.
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+// counters are the per-group counters updated as the group is used.
+type counters struct {
+	Gets           AtomicInt // any Get request, including from peers
+	CacheHits      AtomicInt // either cache was good
+	NegativeHits   AtomicInt // key remembered as not found
+	PeerLoads      AtomicInt // either remote load or remote cache hit (not an error)
+	PeerErrors     AtomicInt
+	Loads          AtomicInt // (gets - cacheHits)
+	LoadsDeduped   AtomicInt // after singleflight
+	LocalLoads     AtomicInt // total good local loads
+	LocalLoadErrs  AtomicInt // total bad local loads
+	Refreshes      AtomicInt // background reloads of expiring values
+	StaleHits      AtomicInt // expired values served while reloaded
+	ServerRequests AtomicInt // gets that came over the network from peers
+}
+
+// Stats is a snapshot of a group's statistics.
+type Stats struct {
+	Gets           int64      `json:"gets"`
+	CacheHits      int64      `json:"cache_hits"`
+	NegativeHits   int64      `json:"negative_hits"`
+	PeerLoads      int64      `json:"peer_loads"`
+	PeerErrors     int64      `json:"peer_errors"`
+	Loads          int64      `json:"loads"`
+	LoadsDeduped   int64      `json:"loads_deduped"`
+	LoadsShared    int64      `json:"loads_shared"`
+	LocalLoads     int64      `json:"local_loads"`
+	LocalLoadErrs  int64      `json:"local_load_errs"`
+	Refreshes      int64      `json:"refreshes"`
+	StaleHits      int64      `json:"stale_hits"`
+	ServerRequests int64      `json:"server_requests"`
+	Evictions      int64      `json:"evictions"` // of both caches
+	Bytes          int64      `json:"bytes"`     // of both caches
+	Items          int64      `json:"items"`     // of both caches
+	MainCache      CacheStats `json:"main_cache"`
+	HotCache       CacheStats `json:"hot_cache"`
+	NegativeCache  CacheStats `json:"negative_cache"`
+}
+
+// Stats returns a snapshot of the group's statistics.
+func (g *Group) Stats() Stats {
+	main, hot := g.mainCache.stats(), g.hotCache.stats()
+	return Stats{
+		Gets:           g.counters.Gets.Get(),
+		CacheHits:      g.counters.CacheHits.Get(),
+		NegativeHits:   g.counters.NegativeHits.Get(),
+		PeerLoads:      g.counters.PeerLoads.Get(),
+		PeerErrors:     g.counters.PeerErrors.Get(),
+		Loads:          g.counters.Loads.Get(),
+		LoadsDeduped:   g.counters.LoadsDeduped.Get(),
+		LoadsShared:    g.loader.Shared(),
+		LocalLoads:     g.counters.LocalLoads.Get(),
+		LocalLoadErrs:  g.counters.LocalLoadErrs.Get(),
+		Refreshes:      g.counters.Refreshes.Get(),
+		StaleHits:      g.counters.StaleHits.Get(),
+		ServerRequests: g.counters.ServerRequests.Get(),
+		Evictions:      main.Evictions + hot.Evictions,
+		Bytes:          main.Bytes + hot.Bytes,
+		Items:          main.Items + hot.Items,
+		MainCache:      main,
+		HotCache:       hot,
+		NegativeCache:  g.negCache.stats(),
+	}
+}
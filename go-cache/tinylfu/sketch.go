@@ -0,0 +1,78 @@
+package tinylfu
+
+import "hash/fnv"
+
+const sketchDepth = 4
+
+// sketch is a count-min sketch of 4-bit counters estimating how often
+// keys were seen. Counters are halved every sampleSize increments so
+// the estimates follow the recent history.
+type sketch struct {
+	rows       [sketchDepth][]byte // two counters per byte
+	mask       uint32
+	additions  int
+	sampleSize int
+}
+
+func newSketch(width int) *sketch {
+	w := 1024
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{mask: uint32(w - 1), sampleSize: 10 * w}
+	for i := range s.rows {
+		s.rows[i] = make([]byte, w/2)
+	}
+	return s
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// index returns the counter of key in row i, derived by double hashing.
+func (s *sketch) index(h uint64, i int) uint32 {
+	h1, h2 := uint32(h), uint32(h>>32)
+	return (h1 + uint32(i)*h2) & s.mask
+}
+
+func (s *sketch) get(row []byte, idx uint32) byte {
+	return (row[idx/2] >> ((idx & 1) * 4)) & 0x0f
+}
+
+func (s *sketch) increment(key string) {
+	h := hashKey(key)
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.get(s.rows[i], idx) < 15 {
+			s.rows[i][idx/2] += 1 << ((idx & 1) * 4)
+		}
+	}
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *sketch) estimate(key string) byte {
+	h := hashKey(key)
+	min := byte(15)
+	for i := range s.rows {
+		if v := s.get(s.rows[i], s.index(h, i)); v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// reset halves all the counters.
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = (s.rows[i][j] >> 1) & 0x77
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,239 @@
+package tinylfu
+
+import (
+	"container/list"
+	"go-cache/lru"
+	"time"
+)
+
+// Value use Len to count how many bytes it takes
+type Value = lru.Value
+
+const (
+	// windowPercent is the share of the budget for the admission window.
+	windowPercent = 1
+	// protectedPercent is the share of the main space for entries
+	// which were used again after admission.
+	protectedPercent = 80
+	// avgEntryBytes sizes the frequency sketch from the budget.
+	avgEntryBytes = 64
+)
+
+// Cache is a W-TinyLFU cache. New entries go to a small LRU window,
+// entries leaving the window are only admitted to the segmented LRU
+// main space when they are used more often than the entry they would
+// replace, which keeps one-off scans from flushing popular entries.
+// It is not safe for concurrent access.
+type Cache struct {
+	maxBytes  int64
+	nbytes    int64
+	window    segment
+	probation segment
+	protected segment
+	freq      *sketch
+	cache     map[string]*list.Element
+	// optional and exectued when an entry is purged.
+	OnEvicted func(key string, value Value)
+}
+
+type segment struct {
+	ll       *list.List
+	nbytes   int64
+	maxBytes int64
+}
+
+type entry struct {
+	key       string
+	value     Value
+	expire    time.Time // zero means the entry never expires
+	seg       *segment
+	candidate bool // moved out of the window, waiting for admission
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key)) + int64(e.value.Len())
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	windowBytes := maxBytes * windowPercent / 100
+	return &Cache{
+		maxBytes:  maxBytes,
+		window:    segment{ll: list.New(), maxBytes: windowBytes},
+		probation: segment{ll: list.New()},
+		protected: segment{ll: list.New(), maxBytes: (maxBytes - windowBytes) * protectedPercent / 100},
+		freq:      newSketch(int(maxBytes / avgEntryBytes)),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// move moves ele to the front of seg.
+func (c *Cache) move(ele *list.Element, seg *segment) {
+	kv := ele.Value.(*entry)
+	size := kv.size()
+	kv.seg.ll.Remove(ele)
+	kv.seg.nbytes -= size
+	kv.seg = seg
+	seg.nbytes += size
+	c.cache[kv.key] = seg.ll.PushFront(kv)
+}
+
+// Get looks up a key's value and records the access. Expired entries
+// are removed and reported as a miss.
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	c.freq.increment(key)
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.touch(ele)
+	return kv.value, true
+}
+
+// touch moves ele to the front of its segment, promoting probation
+// entries to the protected segment.
+func (c *Cache) touch(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	switch kv.seg {
+	case &c.window, &c.protected:
+		kv.seg.ll.MoveToFront(ele)
+	case &c.probation:
+		kv.candidate = false
+		c.move(ele, &c.protected)
+		for c.maxBytes != 0 && c.protected.nbytes > c.protected.maxBytes && c.protected.ll.Len() > 1 {
+			c.move(c.protected.ll.Back(), &c.probation)
+		}
+	}
+}
+
+// Remove removes the provided key from the cache.
+func (c *Cache) Remove(key string) {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// RemoveOldest evicts one entry: an admission candidate which lost
+// against the probation victim, or else the victim itself.
+func (c *Cache) RemoveOldest() {
+	victim := c.probation.ll.Back()
+	if victim == nil {
+		victim = c.protected.ll.Back()
+	}
+	var candidate *list.Element
+	if front := c.probation.ll.Front(); front != nil && front != victim && front.Value.(*entry).candidate {
+		candidate = front
+	}
+	if victim == nil {
+		// the main space is empty, evict from the window
+		if ele := c.window.ll.Back(); ele != nil {
+			c.removeElement(ele)
+		}
+		return
+	}
+	if candidate == nil {
+		c.removeElement(victim)
+		return
+	}
+
+	kv := candidate.Value.(*entry)
+	if c.freq.estimate(kv.key) > c.freq.estimate(victim.Value.(*entry).key) {
+		kv.candidate = false
+		c.removeElement(victim)
+	} else {
+		c.removeElement(candidate)
+	}
+}
+
+// RemoveExpired removes all entries whose expiry has passed.
+func (c *Cache) RemoveExpired() {
+	now := time.Now()
+	for _, seg := range []*segment{&c.window, &c.probation, &c.protected} {
+		for ele := seg.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeElement(ele)
+			}
+			ele = prev
+		}
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	size := kv.size()
+	kv.seg.ll.Remove(ele)
+	kv.seg.nbytes -= size
+	c.nbytes -= size
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+// Add adds a value that never expires to the cache.
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+// AddWithExpire adds a value to the cache which expires at expire.
+// A zero expire means the value never expires.
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	c.freq.increment(key)
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		delta := int64(value.Len()) - int64(kv.value.Len())
+		kv.seg.nbytes += delta
+		c.nbytes += delta
+		kv.value = value
+		kv.expire = expire
+		c.touch(ele)
+	} else {
+		kv := &entry{key: key, value: value, expire: expire, seg: &c.window}
+		c.window.nbytes += kv.size()
+		c.nbytes += kv.size()
+		c.cache[key] = c.window.ll.PushFront(kv)
+	}
+	if c.maxBytes == 0 {
+		return
+	}
+
+	// entries leaving the window become candidates for the main space
+	for c.window.nbytes > c.window.maxBytes && c.window.ll.Len() > 1 {
+		ele := c.window.ll.Back()
+		ele.Value.(*entry).candidate = true
+		c.move(ele, &c.probation)
+	}
+	for c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+// Walk calls fn for every entry, from the probation segment's least
+// recently used to the window's most recently used.
+func (c *Cache) Walk(fn func(key string, value Value, expire time.Time)) {
+	for _, seg := range []*segment{&c.probation, &c.protected, &c.window} {
+		for ele := seg.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			fn(kv.key, kv.value, kv.expire)
+		}
+	}
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes returns the number of bytes taken by the keys and values.
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
@@ -0,0 +1,80 @@
+package tinylfu
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Fatal("cache hit key1=1234 failed")
+	}
+	if _, ok := lfu.Get("key2"); ok {
+		t.Fatalf("cache miss key2 failed")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	lfu := New(int64(1000), nil)
+	// 10 hot entries of 10 bytes, used a few times each
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("hot%d", i)
+		for j := 0; j < 3; j++ {
+			if _, ok := lfu.Get(key); !ok {
+				lfu.Add(key, String("value1"))
+			}
+		}
+	}
+	// a scan of one-off keys is not admitted over the hot ones
+	for i := 0; i < 1000; i++ {
+		lfu.Add(fmt.Sprintf("scan%04d", i), String("value1"))
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := lfu.Get(fmt.Sprintf("hot%d", i)); !ok {
+			t.Fatalf("hot key hot%d flushed by a scan", i)
+		}
+	}
+	if lfu.Bytes() > 1000 {
+		t.Fatalf("expected to stay within 1000 bytes but got %d", lfu.Bytes())
+	}
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch(64)
+	for i := 0; i < 20; i++ {
+		s.increment("a")
+	}
+	s.increment("b")
+	if s.estimate("a") != 15 || s.estimate("b") < 1 || s.estimate("c") != 0 {
+		t.Fatalf("unexpected estimates a=%d b=%d c=%d", s.estimate("a"), s.estimate("b"), s.estimate("c"))
+	}
+	s.reset()
+	if s.estimate("a") != 7 {
+		t.Fatalf("expected a to be halved but got %d", s.estimate("a"))
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.AddWithExpire("key1", String("1"), time.Now().Add(-time.Second))
+	lfu.Add("key2", String("2"))
+	lfu.RemoveExpired()
+
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 1 {
+		t.Fatalf("RemoveExpired key1 failed")
+	}
+	lfu.Remove("key2")
+	if lfu.Len() != 0 || lfu.Bytes() != 0 {
+		t.Fatalf("Remove key2 failed")
+	}
+}
@@ -0,0 +1,138 @@
+package gocache
+
+import (
+	"context"
+	"go-cache/lru"
+	"sync"
+)
+
+// A TypedGetter loads the value of type T for a key.
+type TypedGetter[T any] interface {
+	Get(ctx context.Context, key string) (T, error)
+}
+
+// A TypedGetterFunc implements TypedGetter with a function.
+type TypedGetterFunc[T any] func(ctx context.Context, key string) (T, error)
+
+// Get implements TypedGetter interface function
+func (f TypedGetterFunc[T]) Get(ctx context.Context, key string) (T, error) {
+	return f(ctx, key)
+}
+
+// A TypedGroup is a Group of values of type T, encoded by a Codec.
+type TypedGroup[T any] struct {
+	group *Group
+	codec Codec[T]
+	mu    sync.Mutex // guards memo
+	// memo holds the decoded values of the keys hit recently, nil
+	// unless Memoize was called
+	memo *lru.Cache
+}
+
+// memoEntry is a value decoded from b.
+type memoEntry[T any] struct {
+	b []byte
+	v T
+}
+
+// Len estimates the size of the decoded value with the encoded one.
+func (e *memoEntry[T]) Len() int {
+	return len(e.b)
+}
+
+// NewTypedGroup creates a Group whose values are loaded by getter and
+// encoded with codec, and returns its typed view.
+func NewTypedGroup[T any](name string, cacheBytes int64, getter TypedGetter[T], codec Codec[T], opts ...GroupOption) *TypedGroup[T] {
+	g := NewGroup(name, cacheBytes, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			v, err := getter.Get(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			return codec.Marshal(v)
+		}), opts...)
+	return Typed(g, codec)
+}
+
+// Typed returns a typed view of g, whose values are encoded with codec.
+func Typed[T any](g *Group, codec Codec[T]) *TypedGroup[T] {
+	return &TypedGroup[T]{group: g, codec: codec}
+}
+
+// Memoize makes t keep the values it decoded, up to about maxBytes of
+// their encoding, so that hits of hot keys are not decoded again. The
+// memoized values are shared by the callers, which must not modify
+// them.
+func (t *TypedGroup[T]) Memoize(maxBytes int64) *TypedGroup[T] {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.memo = lru.New(maxBytes, nil)
+	return t
+}
+
+// Group returns the underlying Group, e.g. to register its peers.
+func (t *TypedGroup[T]) Group() *Group {
+	return t.group
+}
+
+func (t *TypedGroup[T]) Get(key string) (T, error) {
+	return t.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but returns ctx.Err() once ctx is done
+// while the value is loading.
+func (t *TypedGroup[T]) GetContext(ctx context.Context, key string) (T, error) {
+	view, err := t.group.GetContext(ctx, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if v, ok := t.lookupMemo(key, view.b); ok {
+		return v, nil
+	}
+	v, err := t.codec.Unmarshal(view.b)
+	if err != nil {
+		return v, err
+	}
+	t.populateMemo(key, view.b, v)
+	return v, nil
+}
+
+// lookupMemo returns the value memoized for key if it was decoded from
+// b itself, the cached bytes of key being replaced when it changes.
+func (t *TypedGroup[T]) lookupMemo(key string, b []byte) (v T, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.memo == nil || len(b) == 0 {
+		return
+	}
+	if e, hit := t.memo.Get(key); hit {
+		e := e.(*memoEntry[T])
+		if len(e.b) == len(b) && &e.b[0] == &b[0] {
+			return e.v, true
+		}
+	}
+	return
+}
+
+func (t *TypedGroup[T]) populateMemo(key string, b []byte, v T) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.memo != nil && len(b) > 0 {
+		t.memo.Add(key, &memoEntry[T]{b: b, v: v})
+	}
+}
+
+// Set encodes v and stores it under key like Group.Set.
+func (t *TypedGroup[T]) Set(key string, v T) error {
+	return t.SetContext(context.Background(), key, v)
+}
+
+// SetContext is like Set, but gives up on the peers once ctx is done.
+func (t *TypedGroup[T]) SetContext(ctx context.Context, key string, v T) error {
+	b, err := t.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.group.SetContext(ctx, key, b)
+}
@@ -0,0 +1,66 @@
+package gocache
+
+import (
+	"context"
+	pb "go-cache/xmcachepb"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+type point struct {
+	X, Y int
+}
+
+func TestTypedGroup(t *testing.T) {
+	var loads int
+	g := NewTypedGroup[*point]("typed", 2<<10, TypedGetterFunc[*point](
+		func(ctx context.Context, key string) (*point, error) {
+			loads++
+			return &point{len(key), 1}, nil
+		}), JSONCodec[*point]{}).Memoize(2 << 10)
+
+	p, err := g.Get("abc")
+	if err != nil || *p != (point{3, 1}) {
+		t.Fatalf("expected {3 1}, got %v, %v", p, err)
+	}
+	if q, _ := g.Get("abc"); q != p || loads != 1 {
+		t.Fatalf("expected the memoized value, got %v after %d loads", q, loads)
+	}
+
+	if err := g.Set("abc", &point{5, 5}); err != nil {
+		t.Fatal(err)
+	}
+	if q, _ := g.Get("abc"); q == p || *q != (point{5, 5}) {
+		t.Fatalf("expected the value set, got %v", q)
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	testCodec[point](t, GobCodec[point]{}, point{1, 2})
+	testCodec[map[string]int](t, JSONCodec[map[string]int]{}, map[string]int{"a": 1})
+
+	req := &pb.Request{Group: "g", Key: "k"}
+	b, err := ProtoCodec[*pb.Request]{}.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := (ProtoCodec[*pb.Request]{}).Unmarshal(b); err != nil || !proto.Equal(got, req) {
+		t.Fatalf("expected %v, got %v, %v", req, got, err)
+	}
+}
+
+func testCodec[T any](t *testing.T, codec Codec[T], v T) {
+	b, err := codec.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := codec.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Fatalf("expected %v, got %v", v, got)
+	}
+}
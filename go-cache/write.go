@@ -0,0 +1,217 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// A Setter is a data source which also stores the values set through
+// the group, with WithWriteThrough or WithWriteBehind.
+type Setter interface {
+	Set(ctx context.Context, key string, value []byte) error
+}
+
+// A BatchSetter is a Setter which also stores several values at once,
+// it is used to write the batches of WithWriteBehind.
+type BatchSetter interface {
+	Setter
+	SetMany(ctx context.Context, values map[string][]byte) error
+}
+
+// A Deleter is a data source which also deletes the keys removed
+// through the group, with WithWriteThrough or WithWriteBehind.
+type Deleter interface {
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	errNotSetter  = errors.New("gocache: the group's Getter is not a Setter")
+	errNotDeleter = errors.New("gocache: the group's Getter is not a Deleter")
+)
+
+// WithWriteThrough makes Set and Remove write to the group's Getter,
+// which must be a Setter and a Deleter respectively, before updating
+// the caches. They fail without updating the caches when the write
+// does.
+func WithWriteThrough() GroupOption {
+	return func(g *Group) {
+		g.writeThrough = true
+	}
+}
+
+// WithWriteBehind makes Set and Remove update the caches right away,
+// and write to the group's Getter in the background every interval.
+// The writes of a key meanwhile are coalesced into the last one, and
+// the values set are written at once if the Getter is a BatchSetter.
+// A failed write is retried at the next intervals, up to maxRetries
+// times, unless the key was written again meanwhile.
+//
+// The pending writes are lost if the process stops before they are
+// written, Flush or Close write them, the latter being meant for
+// graceful shutdown. Until then, the group's own loads return the
+// pending writes, but the peers not caching a key may load its
+// previous value from the data source.
+func WithWriteBehind(interval time.Duration, maxRetries int) GroupOption {
+	return func(g *Group) {
+		g.writer = &writeBehind{
+			interval:   interval,
+			maxRetries: maxRetries,
+			pending:    make(map[string]*pendingWrite),
+			done:       make(chan struct{}),
+		}
+	}
+}
+
+// writeBehind holds the pending writes of a group.
+type writeBehind struct {
+	interval   time.Duration
+	maxRetries int
+	mu         sync.Mutex // guards pending and flushing
+	pending    map[string]*pendingWrite
+	flushing   map[string]*pendingWrite // being written by Flush
+	flushMu    sync.Mutex               // serializes the flushes, keeping writes in order
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+type pendingWrite struct {
+	value    []byte
+	deleted  bool
+	attempts int
+}
+
+// write persists the write of key to the data source as configured.
+func (g *Group) write(ctx context.Context, key string, value []byte, deleted bool) error {
+	if !g.writeThrough && g.writer == nil {
+		return nil
+	}
+	if _, ok := g.getter.(Deleter); deleted && !ok {
+		return errNotDeleter
+	}
+	if _, ok := g.getter.(Setter); !deleted && !ok {
+		return errNotSetter
+	}
+	if g.writeThrough {
+		return g.writeSource(ctx, key, value, deleted)
+	}
+	g.writer.mu.Lock()
+	g.writer.pending[key] = &pendingWrite{value: value, deleted: deleted}
+	g.writer.mu.Unlock()
+	return nil
+}
+
+func (g *Group) writeSource(ctx context.Context, key string, value []byte, deleted bool) error {
+	if deleted {
+		return g.getter.(Deleter).Delete(ctx, key)
+	}
+	return g.getter.(Setter).Set(ctx, key, value)
+}
+
+// writeLoop flushes the pending writes every interval until the group
+// is closed.
+func (g *Group) writeLoop() {
+	ticker := time.NewTicker(g.writer.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := g.Flush(context.Background()); err != nil {
+				log.Println("[XmCache] Failed to write behind", err)
+			}
+		case <-g.writer.done:
+			return
+		}
+	}
+}
+
+// Flush writes the pending writes of WithWriteBehind to the data
+// source and returns the first error. The failed writes stay pending
+// to be retried.
+func (g *Group) Flush(ctx context.Context) error {
+	w := g.writer
+	if w == nil {
+		return nil
+	}
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = make(map[string]*pendingWrite)
+	w.flushing = batch
+	w.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	failed := make(map[string]error)
+	sets := make(map[string][]byte)
+	for key, pw := range batch {
+		if !pw.deleted {
+			sets[key] = pw.value
+			continue
+		}
+		if err := g.writeSource(ctx, key, nil, true); err != nil {
+			failed[key] = err
+		}
+	}
+	if bs, ok := g.getter.(BatchSetter); ok && len(sets) > 0 {
+		if err := bs.SetMany(ctx, sets); err != nil {
+			for key := range sets {
+				failed[key] = err
+			}
+		}
+	} else {
+		for key, value := range sets {
+			if err := g.writeSource(ctx, key, value, false); err != nil {
+				failed[key] = err
+			}
+		}
+	}
+
+	var first error
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flushing = nil
+	for key, err := range failed {
+		if first == nil {
+			first = err
+		}
+		pw := batch[key]
+		pw.attempts++
+		if _, ok := w.pending[key]; ok {
+			continue // overwritten meanwhile
+		}
+		if pw.attempts > w.maxRetries {
+			log.Println("[XmCache] Dropping the write of", key, err)
+			continue
+		}
+		w.pending[key] = pw
+	}
+	return first
+}
+
+// pendingValue returns the value of key not yet written by
+// WithWriteBehind, so that the loads do not read the previous value
+// back from the data source. ok is false when no write is pending.
+func (g *Group) pendingValue(key string) (value ByteView, ok bool, err error) {
+	w := g.writer
+	if w == nil {
+		return ByteView{}, false, nil
+	}
+	w.mu.Lock()
+	pw, ok := w.pending[key]
+	if !ok {
+		pw, ok = w.flushing[key]
+	}
+	w.mu.Unlock()
+	if !ok {
+		return ByteView{}, false, nil
+	}
+	if pw.deleted {
+		return ByteView{}, true, ErrNotFound
+	}
+	return ByteView{b: cloneBytes(pw.value), e: g.expireAt(0)}, true, nil
+}
@@ -0,0 +1,191 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// store is a data source which is a BatchSetter and a Deleter.
+type store struct {
+	mu      sync.Mutex
+	data    map[string]string
+	batches int
+	err     error // returned by the writes when set
+}
+
+func (s *store) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.data[key]; ok {
+		return []byte(v), nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *store) Set(ctx context.Context, key string, value []byte) error {
+	return s.SetMany(ctx, map[string][]byte{key: value})
+}
+
+func (s *store) SetMany(ctx context.Context, values map[string][]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches++
+	if s.err != nil {
+		return s.err
+	}
+	for k, v := range values {
+		s.data[k] = string(v)
+	}
+	return nil
+}
+
+func (s *store) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.data, key)
+	return nil
+}
+
+func (s *store) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func TestWriteThrough(t *testing.T) {
+	s := &store{data: map[string]string{"Tom": "630"}}
+	g := NewGroup("write-through", 2<<10, s, WithWriteThrough())
+
+	if err := g.Set("Jack", []byte("589")); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.get("Jack"); v != "589" {
+		t.Fatalf("expected the value to be written, got %q", v)
+	}
+	if err := g.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.get("Tom"); ok {
+		t.Fatalf("expected the key to be deleted")
+	}
+
+	s.err = errors.New("store down")
+	if err := g.Set("Jack", []byte("0")); err != s.err {
+		t.Fatalf("expected the write's error, got %v", err)
+	}
+	if v, _ := g.Get("Jack"); v.String() != "589" {
+		t.Fatalf("expected a failed write to leave the cache alone, got %q", v)
+	}
+
+	readOnly := NewGroup("read-only", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, ErrNotFound
+		}), WithWriteThrough())
+	if err := readOnly.Set("Jack", []byte("589")); err != errNotSetter {
+		t.Fatalf("expected errNotSetter, got %v", err)
+	}
+}
+
+func TestWriteBehind(t *testing.T) {
+	s := &store{data: map[string]string{"Tom": "630"}}
+	g := NewGroup("write-behind", 2<<10, s, WithWriteBehind(time.Hour, 1))
+
+	g.Set("Jack", []byte("1"))
+	g.Set("Jack", []byte("2"))
+	g.Set("Sam", []byte("3"))
+	g.Remove("Tom")
+	if v, _ := g.Get("Jack"); v.String() != "2" {
+		t.Fatalf("expected the cache to be updated right away, got %q", v)
+	}
+	if _, ok := s.get("Jack"); ok {
+		t.Fatalf("expected the write to be pending")
+	}
+	if err := g.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.get("Jack"); v != "2" || s.batches != 1 {
+		t.Fatalf("expected the last value in a single batch, got %q in %d batches", v, s.batches)
+	}
+	if _, ok := s.get("Tom"); ok {
+		t.Fatalf("expected the key to be deleted")
+	}
+
+	// a failed write is retried once, then dropped
+	s.err = errors.New("store down")
+	g.Set("Jack", []byte("4"))
+	for i := 0; i < 3; i++ {
+		if err := g.Flush(context.Background()); (err != nil) != (i < 2) {
+			t.Fatalf("flush %d: unexpected error %v", i, err)
+		}
+	}
+	if s.batches != 3 {
+		t.Fatalf("expected 2 attempts, got %d", s.batches-1)
+	}
+
+	s.err = nil
+	g.Set("Jack", []byte("5"))
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.get("Jack"); v != "5" {
+		t.Fatalf("expected Close to write the pending writes, got %q", v)
+	}
+}
+
+func TestWriteBehindInterval(t *testing.T) {
+	s := &store{data: map[string]string{}}
+	g := NewGroup("write-behind-interval", 2<<10, s, WithWriteBehind(10*time.Millisecond, 0))
+	defer g.Close()
+	g.Set("Jack", []byte("589"))
+	if !waitFor(func() bool { _, ok := s.get("Jack"); return ok }) {
+		t.Fatalf("expected the write to happen in the background")
+	}
+}
+
+// batchStore is a store which is also a BatchGetter.
+type batchStore struct {
+	*store
+}
+
+func (s batchStore) GetMany(keys []string) (map[string][]byte, error) {
+	values := make(map[string][]byte)
+	for _, key := range keys {
+		if v, ok := s.get(key); ok {
+			values[key] = []byte(v)
+		}
+	}
+	return values, nil
+}
+
+func TestWriteBehindPending(t *testing.T) {
+	for _, getter := range []Getter{
+		&store{data: map[string]string{"Tom": "630", "Jack": "589"}},
+		batchStore{&store{data: map[string]string{"Tom": "630", "Jack": "589"}}},
+	} {
+		// too small to hold anything, so the values are loaded
+		g := NewGroup("write-behind-pending", 1, getter, WithWriteBehind(time.Hour, 1))
+		g.Set("Jack", []byte("1"))
+		g.Remove("Tom")
+
+		if v, err := g.Get("Jack"); err != nil || v.String() != "1" {
+			t.Fatalf("expected the pending value, got %q, %v", v, err)
+		}
+		if _, err := g.Get("Tom"); err != ErrNotFound {
+			t.Fatalf("expected the pending delete to be ErrNotFound, got %v", err)
+		}
+		values, err := g.GetMany([]string{"Jack", "Tom"})
+		if v := values["Jack"]; v.String() != "1" {
+			t.Fatalf("expected GetMany to return the pending value, got %q", v)
+		}
+		if _, ok := values["Tom"]; ok || err != ErrNotFound {
+			t.Fatalf("expected GetMany to honor the pending delete, got %v", err)
+		}
+	}
+}
@@ -1,13 +1,22 @@
 package gocache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"go-cache/singleflight"
 	pb "go-cache/xmcachepb"
 	"log"
+	"math/rand"
 	"sync"
+	"time"
 )
 
+// ErrNotFound is returned by a Getter when the key doesn't exist. The
+// groups configured with WithNegativeCache remember it for a while
+// instead of asking the Getter again.
+var ErrNotFound = errors.New("gocache: not found")
+
 // A Getter loads data for a key.
 type Getter interface {
 	Get(key string) ([]byte, error)
@@ -21,36 +30,337 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// A GetterWithTTL is a Getter which also decides how long the loaded
+// data stays valid. A zero ttl falls back to the group's default TTL.
+type GetterWithTTL interface {
+	Getter
+	GetWithTTL(key string) (value []byte, ttl time.Duration, err error)
+}
+
+// A GetterWithTTLFunc implements GetterWithTTL with a function.
+type GetterWithTTLFunc func(key string) ([]byte, time.Duration, error)
+
+// Get implements Getter interface function
+func (f GetterWithTTLFunc) Get(key string) ([]byte, error) {
+	v, _, err := f(key)
+	return v, err
+}
+
+// GetWithTTL implements GetterWithTTL interface function
+func (f GetterWithTTLFunc) GetWithTTL(key string) ([]byte, time.Duration, error) {
+	return f(key)
+}
+
+// A ContextGetter is a Getter which gives up loading once ctx is done.
+type ContextGetter interface {
+	Getter
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+// A ContextGetterFunc implements ContextGetter with a function.
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get implements Getter interface function
+func (f ContextGetterFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// GetContext implements ContextGetter interface function
+func (f ContextGetterFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// A Result is the data loaded by a ResultGetter along with how to
+// cache it.
+type Result struct {
+	Value []byte
+	// TTL of the data, zero falls back to the group's default TTL.
+	TTL time.Duration
+	// Tags of the data, InvalidateTag drops it along with the other
+	// data of a tag.
+	Tags []string
+}
+
+// A ResultGetter is a Getter which gives up loading once ctx is done,
+// and decides how long the loaded data stays valid and its tags. It
+// takes precedence over ContextGetter, which takes precedence over
+// GetterWithTTL, so the Getters needing more than one of these
+// implement ResultGetter instead.
+type ResultGetter interface {
+	Getter
+	GetResult(ctx context.Context, key string) (Result, error)
+}
+
+// A ResultGetterFunc implements ResultGetter with a function.
+type ResultGetterFunc func(ctx context.Context, key string) (Result, error)
+
+// Get implements Getter interface function
+func (f ResultGetterFunc) Get(key string) ([]byte, error) {
+	res, err := f(context.Background(), key)
+	return res.Value, err
+}
+
+// GetResult implements ResultGetter interface function
+func (f ResultGetterFunc) GetResult(ctx context.Context, key string) (Result, error) {
+	return f(ctx, key)
+}
+
+// A BatchGetter is a Getter which also loads several keys at once,
+// it is used by GetMany. The keys missing from values are not found,
+// as if Get returned ErrNotFound.
+type BatchGetter interface {
+	Getter
+	GetMany(keys []string) (values map[string][]byte, err error)
+}
+
+// A BatchResultGetter is a BatchGetter which also gives up loading once
+// ctx is done, and returns the TTL and tags of the values as
+// ResultGetter does.
+type BatchResultGetter interface {
+	BatchGetter
+	GetManyResults(ctx context.Context, keys []string) (results map[string]Result, err error)
+}
+
+// A BatchGetterFunc implements BatchGetter with a function.
+type BatchGetterFunc func(keys []string) (map[string][]byte, error)
+
+// Get implements Getter interface function
+func (f BatchGetterFunc) Get(key string) ([]byte, error) {
+	values, err := f([]string{key})
+	if err != nil {
+		return nil, err
+	}
+	v, ok := values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+// GetMany implements BatchGetter interface function
+func (f BatchGetterFunc) GetMany(keys []string) (map[string][]byte, error) {
+	return f(keys)
+}
+
 // A Group is a cache namespace and associated data loaded spread over
 type Group struct {
-	name      string
-	getter    Getter
-	mainCache cache
-	peers     PeerPicker
+	name       string
+	getter     Getter
+	cacheBytes int64 // limit for sum of mainCache and hotCache size
+	// memory bounds the caches instead of cacheBytes when set
+	memory *MemoryManager
+	share  Share
+	// bytes of the main and hot caches, kept up to date on add and
+	// evict so that budgets are checked without locking the shards
+	mainUsage AtomicInt
+	hotUsage  AtomicInt
+	// mainCache is a cache of the keys for which this process
+	// is authoritative.
+	mainCache *cache
+	// hotCache contains keys/values for which this peer is not
+	// authoritative, but are popular enough to warrant mirroring
+	// in this process to avoid going over the network.
+	hotCache *cache
+	// negCache remembers the keys which were not found, it has a
+	// budget of its own.
+	negCache *cache
+	negTTL   time.Duration // zero disables negCache
+	negBytes int64
+	peers    PeerPicker
 	// use singleflight.Group to make sure that
 	// each key is only fetched once
 	loader *singleflight.Group
+	// default time to live of loaded values, zero means never expire
+	ttl time.Duration
+	// bound of a load shared by concurrent callers, zero means none
+	loadTimeout time.Duration
+	policy      PolicyFunc
+	shards      int // number of shards of mainCache
+	// how long before their expiry the values of mainCache are
+	// reloaded in the background when accessed
+	refreshAhead time.Duration
+	// how long after their expiry the values of mainCache are
+	// served stale while reloaded in the background
+	staleGrace   time.Duration
+	staleOnError StaleErrorMode
+	refreshing   sync.Map // keys reloaded in the background
+	// whether the values loaded or set here as primary owner are
+	// pushed to the key's replicas
+	pushReplicas bool
+	snapshotFile string // restored on creation and written on Close
+	// how Set and Remove write to the Getter, not at all by default
+	writeThrough bool
+	writer       *writeBehind
+
+	counters counters
+}
+
+// A GroupOption configures a Group created by NewGroup.
+type GroupOption func(*Group)
+
+// WithPolicy sets the eviction policy of the group's caches, the
+// default is LRU.
+func WithPolicy(newPolicy PolicyFunc) GroupOption {
+	return func(g *Group) {
+		g.policy = newPolicy
+	}
+}
+
+// WithShards splits the group's main cache into n shards, each with
+// its own lock and 1/n of the budget, so that concurrent lookups of
+// different keys don't contend. The default is a single shard.
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
 }
 
+// WithLoadTimeout bounds how long a load may take. A load is shared
+// by all the callers asking for the key meanwhile, so it is not
+// cancelled when one of them gives up, only once the timeout expires.
+func WithLoadTimeout(timeout time.Duration) GroupOption {
+	return func(g *Group) {
+		g.loadTimeout = timeout
+	}
+}
+
+// WithTTL sets the default time to live of the values loaded by the
+// group's Getter.
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithRefreshAhead makes the group reload in the background the values
+// accessed within window before their expiry, so that popular keys
+// don't expire. The reloads go through the loader, concurrent ones
+// are shared.
+func WithRefreshAhead(window time.Duration) GroupOption {
+	return func(g *Group) {
+		g.refreshAhead = window
+	}
+}
+
+// A StaleErrorMode decides what becomes of a stale value when its
+// reload fails.
+type StaleErrorMode int
+
+const (
+	// ServeStaleOnError keeps serving the stale value until the end
+	// of the grace period, the next accesses retry the reload.
+	ServeStaleOnError StaleErrorMode = iota
+	// DropStaleOnError drops the stale value, the next Get loads the
+	// key again and returns the loader's error.
+	DropStaleOnError
+)
+
+// WithStaleWhileRevalidate keeps the values of the main cache for
+// grace after they expire. A Get of such a stale value returns it
+// right away and reloads it in the background, onError decides what
+// becomes of it when the reload fails.
+func WithStaleWhileRevalidate(grace time.Duration, onError StaleErrorMode) GroupOption {
+	return func(g *Group) {
+		g.staleGrace = grace
+		g.staleOnError = onError
+	}
+}
+
+// WithReplicaPush makes the group push the values it loads or sets as
+// the primary owner of a key to the other owners, so that they can
+// serve the key from their main cache when the primary is down.
+func WithReplicaPush() GroupOption {
+	return func(g *Group) {
+		g.pushReplicas = true
+	}
+}
+
+// defaultNegativeBytes bounds the negative cache when WithNegativeCache
+// is given no bound.
+const defaultNegativeBytes = 1 << 20
+
+// WithNegativeCache makes the group remember for ttl that the Getter
+// returned ErrNotFound for a key. The keys remembered take up to
+// maxBytes, apart from the group's budget, so that lookups of random
+// missing keys can't grow the memory. A maxBytes <= 0 falls back to
+// 1MB rather than no bound.
+func WithNegativeCache(ttl time.Duration, maxBytes int64) GroupOption {
+	return func(g *Group) {
+		if maxBytes <= 0 {
+			maxBytes = defaultNegativeBytes
+		}
+		g.negTTL = ttl
+		g.negBytes = maxBytes
+	}
+}
+
+const (
+	// hotCacheSampling is the inverse of the fraction of values
+	// loaded from peers which are mirrored in the hot cache.
+	hotCacheSampling = 10
+	// hotCacheRatio bounds the hot cache to 1/hotCacheRatio of
+	// the main cache's size when the group is over its budget.
+	hotCacheRatio = 8
+	// peerWriteTimeout bounds the writes and invalidations sent to
+	// the peers when the caller's ctx has no deadline, so that a
+	// peer not answering can't stall them.
+	peerWriteTimeout = 5 * time.Second
+)
+
+// ErrStaleCopies is wrapped by the errors of Set and Remove once the
+// write itself is done, with the owner of the key and the Getter, but
+// some peers could not update or drop their copy of the key. They may
+// serve it until it expires.
+var ErrStaleCopies = errors.New("gocache: peers may keep a stale copy")
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
 )
 
 // NewGroup create a new instance of Group
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
 	mu.Lock()
 	defer mu.Unlock()
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:       name,
+		getter:     getter,
+		cacheBytes: cacheBytes,
+		loader:     &singleflight.Group{},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	policyBytes := g.cacheBytes
+	if g.memory != nil {
+		g.cacheBytes = 0
+		// the policies still need a bound to choose what to keep,
+		// the most memory the group may use
+		policyBytes = g.share.MaxBytes
+		if policyBytes <= 0 {
+			policyBytes = g.memory.maxBytes
+		}
+	}
+	g.mainCache = newCache(g.shards, policyBytes, g.policy)
+	g.mainCache.grace = g.staleGrace
+	g.hotCache = newCache(1, policyBytes/hotCacheRatio, g.policy)
+	g.negCache = newCache(1, g.negBytes, LRU)
+	g.mainCache.trackUsage(&g.mainUsage)
+	g.hotCache.trackUsage(&g.hotUsage)
+	if g.memory != nil {
+		g.memory.register(g)
+	}
+	if g.snapshotFile != "" {
+		g.restoreFile()
+	}
+	if g.writer != nil && g.writer.interval > 0 {
+		go g.writeLoop()
 	}
 	groups[name] = g
+	purgeOnce.Do(func() { go purgeLoop() })
 	return g
 }
 
@@ -63,32 +373,146 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+// allGroups returns all the groups created with NewGroup.
+func allGroups() []*Group {
+	mu.RLock()
+	defer mu.RUnlock()
+	all := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		all = append(all, g)
+	}
+	return all
+}
+
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but returns ctx.Err() once ctx is done
+// while the value is loading.
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
 
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[XmCache] hit")
+	g.counters.Gets.Add(1)
+	if v, ok := g.lookupCache(key); ok {
+		g.counters.CacheHits.Add(1)
 		return v, nil
 	}
+	if g.lookupNegative(key) {
+		g.counters.NegativeHits.Add(1)
+		return ByteView{}, ErrNotFound
+	}
+
+	return g.load(ctx, key)
+}
+
+func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
+	if value, ok = g.mainCache.get(key); ok {
+		g.revalidate(key, value)
+		return
+	}
+	value, ok = g.hotCache.get(key)
+	return
+}
+
+// revalidate reloads in the background a value of the main cache which
+// is about to expire or stale.
+func (g *Group) revalidate(key string, value ByteView) {
+	expire := value.Expire()
+	if expire.IsZero() || time.Until(expire) >= g.refreshAhead {
+		return
+	}
+	stale := !time.Now().Before(expire)
+	if stale {
+		g.counters.StaleHits.Add(1)
+	}
+	// the reload is shared with the loads in flight, but not with
+	// the ones starting after it
+	if _, loaded := g.refreshing.LoadOrStore(key, true); loaded {
+		return
+	}
+	go func() {
+		defer g.refreshing.Delete(key)
+		g.counters.Refreshes.Add(1)
+		if _, err := g.load(context.Background(), key); err != nil {
+			log.Println("[XmCache] Failed to refresh", key, err)
+			if stale && g.staleOnError == DropStaleOnError {
+				// only the stale value, not one set meanwhile
+				g.mainCache.removeIf(key, func(v ByteView) bool {
+					return v.Expire().Equal(expire)
+				})
+			}
+		}
+	}()
+}
 
-	return g.load(key)
+// lookupNegative reports whether key is remembered as not found.
+func (g *Group) lookupNegative(key string) bool {
+	if g.negTTL <= 0 {
+		return false
+	}
+	_, ok := g.negCache.get(key)
+	return ok
 }
 
-func (g *Group) load(key string) (value ByteView, err error) {
+// populateNegative remembers that key was not found.
+func (g *Group) populateNegative(key string) {
+	if g.negTTL > 0 {
+		g.negCache.add(key, ByteView{e: time.Now().Add(g.negTTL)})
+	}
+}
+
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
+	g.counters.Loads.Add(1)
 	// each key is only fetched once (either locally or remotely)
 	// regardless of the number of concurrent callers.
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
+	viewi, err, _ := g.loader.DoContext(ctx, key, func() (interface{}, error) {
+		g.counters.LoadsDeduped.Add(1)
+		ctx := context.Context(detachedContext{ctx})
+		if g.loadTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, g.loadTimeout)
+			defer cancel()
+		}
+		var replicas []PeerGetter
 		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				if value, err = g.getFromPeer(peer, key); err == nil {
+			peers, primary := g.peers.PickPeer(key)
+			if primary {
+				replicas = peers
+			}
+			for i := 0; !primary && i < len(peers); i++ {
+				value, err := g.getFromPeer(ctx, peers[i], key)
+				if err == nil {
+					g.counters.PeerLoads.Add(1)
+					// Only mirror a sample of the remote values, the
+					// popular keys are the ones likely to be sampled.
+					if rand.Intn(hotCacheSampling) == 0 {
+						g.popluateCache(key, value, g.hotCache)
+					}
 					return value, nil
 				}
+				if errors.Is(err, ErrNotFound) {
+					// the owner's answer, the Getter would agree
+					g.populateNegative(key)
+					return nil, err
+				}
+				g.counters.PeerErrors.Add(1)
 				log.Println("[XmCache] Failed to get from peer", err)
 			}
 		}
-		return g.getLocally(key)
+		value, err := g.getLocally(ctx, key)
+		if err != nil {
+			g.counters.LocalLoadErrs.Add(1)
+			return nil, err
+		}
+		g.counters.LocalLoads.Add(1)
+		if g.pushReplicas && len(replicas) > 0 {
+			// the callers don't wait for the replicas
+			go g.setOnPeers(context.Background(), key, value, replicas)
+		}
+		return value, nil
 	})
 	if err == nil {
 		return viewi.(ByteView), nil
@@ -96,31 +520,314 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+// detachedContext carries the values of its parent but is never done,
+// so a load shared by several callers outlives the one starting it.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
+
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	err := peer.Get(ctx, req, res)
 	if err != nil {
 		return ByteView{}, err
 	}
-	return ByteView{b: res.Value}, nil
+	return responseView(res), nil
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	if value, ok, err := g.pendingValue(key); ok {
+		if err != nil {
+			return ByteView{}, err
+		}
+		g.popluateCache(key, value, g.mainCache)
+		return value, nil
+	}
+	var (
+		res Result
+		err error
+	)
+	switch getter := g.getter.(type) {
+	case ResultGetter:
+		res, err = getter.GetResult(ctx, key)
+	case ContextGetter:
+		res.Value, err = getter.GetContext(ctx, key)
+	case GetterWithTTL:
+		res.Value, res.TTL, err = getter.GetWithTTL(key)
+	default:
+		res.Value, err = g.getter.Get(key)
+	}
 	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			g.populateNegative(key)
+		}
 		return ByteView{}, err
 	}
-	value := ByteView{b: cloneBytes(bytes)}
-	g.popluateCache(key, value)
+	value := g.resultView(res)
+	g.popluateCache(key, value, g.mainCache)
 	return value, nil
 }
 
-func (g *Group) popluateCache(key string, value ByteView) {
-	g.mainCache.add(key, value)
+// resultView returns the view of res cached by the group.
+func (g *Group) resultView(res Result) ByteView {
+	return ByteView{b: cloneBytes(res.Value), e: g.expireAt(res.TTL), tags: res.Tags}
+}
+
+// expireAt returns the expiry of a value loaded now with ttl,
+// falling back to the group's default TTL when ttl is zero.
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl == 0 {
+		ttl = g.ttl
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func (g *Group) popluateCache(key string, value ByteView, cache *cache) {
+	cache.add(key, value)
+	if g.memory != nil {
+		g.memory.reclaim(g)
+		return
+	}
+	if g.cacheBytes <= 0 {
+		return
+	}
+
+	// Evict items from cache(s) if necessary.
+	for g.bytes() > g.cacheBytes {
+		if !g.evictOne() {
+			break
+		}
+	}
+}
+
+// bytes returns the size of the main and hot caches.
+func (g *Group) bytes() int64 {
+	return g.mainUsage.Get() + g.hotUsage.Get()
+}
+
+// evictOne evicts an entry from the main cache, or from the hot cache
+// when it is over its share of the main cache's size. It reports
+// whether an entry was evicted.
+func (g *Group) evictOne() bool {
+	mainBytes := g.mainUsage.Get()
+	hotBytes := g.hotUsage.Get()
+	victim, other := g.mainCache, g.hotCache
+	if hotBytes > mainBytes/hotCacheRatio {
+		victim, other = g.hotCache, g.mainCache
+	}
+	return victim.removeOldest() || other.removeOldest()
+}
+
+// CacheType represents a type of cache.
+type CacheType int
+
+const (
+	// The MainCache is the cache for items that this peer is the
+	// owner for.
+	MainCache CacheType = iota + 1
+
+	// The HotCache is the cache for items that seem popular
+	// enough to replicate to this node, even though it's not the
+	// owner.
+	HotCache
+
+	// The NegativeCache is the cache for the keys which were not
+	// found.
+	NegativeCache
+)
+
+// CacheStats returns stats about the provided cache within the group.
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	case NegativeCache:
+		return g.negCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
+// Set stores value under key on the peer owning the key, and its
+// replicas with WithReplicaPush, and drops any copy of the key held by
+// the other peers. With WithWriteThrough or WithWriteBehind, the value
+// is also written to the group's Getter, first, and stays written
+// when storing it on the owner fails. The failures of the other peers
+// are reported as ErrStaleCopies.
+func (g *Group) Set(key string, value []byte) error {
+	return g.SetContext(context.Background(), key, value)
+}
+
+// SetContext is like Set, but gives up on the peers once ctx is done.
+func (g *Group) SetContext(ctx context.Context, key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	view := ByteView{b: cloneBytes(value), e: g.expireAt(0)}
+	if err := g.write(ctx, key, view.b, false); err != nil {
+		return err
+	}
+	if g.peers == nil {
+		g.setLocally(key, view)
+		return nil
+	}
+	ctx, cancel := peerContext(ctx)
+	defer cancel()
+
+	peers, primary := g.peers.PickPeer(key)
+	var written, replicas []PeerGetter
+	if primary || len(peers) == 0 {
+		g.setLocally(key, view)
+		replicas = peers
+	} else {
+		if err := g.setOnPeers(ctx, key, view, peers[:1]); err != nil {
+			return err
+		}
+		g.removeLocally(key)
+		written, replicas = peers[:1], peers[1:]
+	}
+	if g.pushReplicas {
+		if err := g.setOnPeers(ctx, key, view, replicas); err != nil {
+			return fmt.Errorf("%w: %v", ErrStaleCopies, err)
+		}
+		written = peers
+	}
+	// the owners set keep the value, the others drop their copy
+	return g.removeFromPeers(ctx, key, written...)
+}
+
+// setOnPeers concurrently stores value under key on peers.
+func (g *Group) setOnPeers(ctx context.Context, key string, value ByteView, peers []PeerGetter) error {
+	req := &pb.SetRequest{
+		Group: g.name,
+		Key:   key,
+		Value: value.b,
+		Tags:  value.tags,
+	}
+	if !value.e.IsZero() {
+		req.Expire = value.e.UnixNano()
+	}
+	return forEachPeer(peers, func(peer PeerGetter) error {
+		err := peer.Set(ctx, req)
+		if err != nil {
+			log.Println("[XmCache] Failed to set on peer", err)
+		}
+		return err
+	})
+}
+
+// Remove drops key from the cache of every peer, including its owner,
+// and deletes it from the group's Getter like Set writes to it. The
+// failures of the peers are reported as ErrStaleCopies.
+func (g *Group) Remove(key string) error {
+	return g.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext is like Remove, but gives up on the peers once ctx
+// is done.
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if err := g.write(ctx, key, nil, true); err != nil {
+		return err
+	}
+	g.removeLocally(key)
+	if g.peers == nil {
+		return nil
+	}
+	ctx, cancel := peerContext(ctx)
+	defer cancel()
+	return g.removeFromPeers(ctx, key)
+}
+
+// peerContext returns ctx bounded by peerWriteTimeout when it has no
+// deadline.
+func peerContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, peerWriteTimeout)
+}
+
+// removeFromPeers concurrently removes key from all peers but skip,
+// the error wraps ErrStaleCopies.
+func (g *Group) removeFromPeers(ctx context.Context, key string, skip ...PeerGetter) error {
+	req := &pb.Request{Group: g.name, Key: key}
+	var peers []PeerGetter
+	for _, peer := range g.peers.GetAll() {
+		if !containsPeer(skip, peer) {
+			peers = append(peers, peer)
+		}
+	}
+	err := forEachPeer(peers, func(peer PeerGetter) error {
+		err := peer.Remove(ctx, req)
+		if err != nil {
+			log.Println("[XmCache] Failed to remove from peer", err)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStaleCopies, err)
+	}
+	return nil
+}
+
+// forEachPeer calls fn concurrently for each peer and returns the
+// first error.
+func forEachPeer(peers []PeerGetter, fn func(PeerGetter) error) error {
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+	)
+	for _, peer := range peers {
+		wg.Add(1)
+		go func(peer PeerGetter) {
+			defer wg.Done()
+			if e := fn(peer); e != nil {
+				once.Do(func() { err = e })
+			}
+		}(peer)
+	}
+	wg.Wait()
+	return err
+}
+
+func containsPeer(peers []PeerGetter, peer PeerGetter) bool {
+	for _, p := range peers {
+		if p == peer {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Group) setLocally(key string, value ByteView) {
+	g.negCache.remove(key)
+	g.popluateCache(key, value, g.mainCache)
+}
+
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+	g.negCache.remove(key)
 }
 
 func (g *Group) RegisterPeers(peers PeerPicker) {
@@ -1,10 +1,21 @@
 package gocache
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	pb "go-cache/xmcachepb"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var db = map[string]string{
@@ -49,3 +60,586 @@ func TestGetter(t *testing.T) {
 		t.Error("callback failed")
 	}
 }
+
+func TestGetWithTTL(t *testing.T) {
+	loads := 0
+	xm := NewGroup("ttl", 2<<10, GetterWithTTLFunc(
+		func(key string) ([]byte, time.Duration, error) {
+			loads++
+			if key == "short" {
+				return []byte(key), 10 * time.Millisecond, nil
+			}
+			return []byte(key), 0, nil
+		}), WithTTL(time.Hour))
+
+	view, err := xm.Get("short")
+	if err != nil || view.Expire().IsZero() {
+		t.Fatalf("expected short to expire")
+	}
+	if view, _ := xm.Get("long"); time.Until(view.Expire()) < time.Minute {
+		t.Fatalf("expected long to fall back to the default ttl")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := xm.Get("short"); err != nil || loads != 3 {
+		t.Fatalf("expired key should be reloaded, loads = %d", loads)
+	}
+	if _, err := xm.Get("long"); err != nil || loads != 3 {
+		t.Fatalf("cache long miss, loads = %d", loads)
+	}
+}
+
+func TestHTTPPoolExpire(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	NewGroup("expire", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithTTL(time.Until(expire)))
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	res := &pb.Response{}
+	if err := getter.Get(context.Background(), &pb.Request{Group: "expire", Key: "k"}, res); err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Value) != "k" || res.Expire < expire.UnixNano() {
+		t.Fatalf("expected the owner's expiry to be sent, got %v", res)
+	}
+}
+
+type fakePeer struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	removed []string
+	err     error // returned by Remove when set
+}
+
+func (p *fakePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	v, ok := p.values[in.Key]
+	if !ok {
+		return fmt.Errorf("%s not exist", in.Key)
+	}
+	out.Value = v
+	return nil
+}
+
+func (p *fakePeer) Set(ctx context.Context, in *pb.SetRequest) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.values[in.Key] = in.Value
+	return nil
+}
+
+func (p *fakePeer) Remove(ctx context.Context, in *pb.Request) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	delete(p.values, in.Key)
+	p.removed = append(p.removed, in.Key)
+	return nil
+}
+
+// fakePeers owns every key starting with "remote" on peers[0], and
+// every key starting with "replicated" on all the peers in order.
+// This peer is the primary owner of the other keys, and with the
+// peers as replicas of the keys starting with "primary".
+type fakePeers []*fakePeer
+
+func (ps fakePeers) PickPeer(key string) ([]PeerGetter, bool) {
+	switch {
+	case strings.HasPrefix(key, "remote"):
+		return []PeerGetter{ps[0]}, false
+	case strings.HasPrefix(key, "replicated"):
+		return ps.GetAll(), false
+	case strings.HasPrefix(key, "primary"):
+		return ps.GetAll(), true
+	}
+	return nil, true
+}
+
+func (ps fakePeers) GetAll() []PeerGetter {
+	var all []PeerGetter
+	for _, p := range ps {
+		all = append(all, p)
+	}
+	return all
+}
+
+func TestSetRemove(t *testing.T) {
+	owner := &fakePeer{values: map[string][]byte{}}
+	other := &fakePeer{values: map[string][]byte{}}
+	xm := NewGroup("set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	xm.RegisterPeers(fakePeers{owner, other})
+
+	if err := xm.Set("local", []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := xm.Get("local"); err != nil || view.String() != "1" {
+		t.Fatalf("failed to get locally owned key after Set")
+	}
+	if err := xm.Set("remote", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := xm.Get("remote"); err != nil || view.String() != "2" {
+		t.Fatalf("failed to get remotely owned key after Set")
+	}
+	if !reflect.DeepEqual(other.removed, []string{"local", "remote"}) {
+		t.Fatalf("non-owner peers should be invalidated, got %v", other.removed)
+	}
+
+	if err := xm.Remove("local"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xm.Get("local"); err == nil {
+		t.Fatalf("local should be removed")
+	}
+	if err := xm.Remove("remote"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xm.Get("remote"); err == nil {
+		t.Fatalf("remote should be removed from its owner")
+	}
+
+	other.err = errors.New("peer down")
+	if err := xm.Set("local", []byte("3")); !errors.Is(err, ErrStaleCopies) {
+		t.Fatalf("expected the failure of a non-owner to be ErrStaleCopies, got %v", err)
+	}
+	if view, err := xm.Get("local"); err != nil || view.String() != "3" {
+		t.Fatalf("expected the owner to keep the value set")
+	}
+}
+
+func TestReplicas(t *testing.T) {
+	down := &fakePeer{values: map[string][]byte{}}
+	replica := &fakePeer{values: map[string][]byte{"replicated": []byte("1")}}
+	var loads int32
+	xm := NewGroup("replicas", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return []byte(key), nil
+		}), WithReplicaPush())
+	xm.RegisterPeers(fakePeers{down, replica})
+
+	if view, err := xm.Get("replicated"); err != nil || view.String() != "1" {
+		t.Fatalf("expected the next owner to serve the key, got %v, %v", view, err)
+	}
+	if s := xm.Stats(); s.PeerErrors != 1 || s.PeerLoads != 1 || loads != 0 {
+		t.Fatalf("expected a failed and a successful peer load, got %+v", s)
+	}
+
+	if view, err := xm.Get("primary"); err != nil || view.String() != "primary" {
+		t.Fatalf("failed to load the primary key locally")
+	}
+	pushed := func(p *fakePeer) bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return string(p.values["primary"]) == "primary"
+	}
+	for i := 0; i < 100 && !(pushed(down) && pushed(replica)); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if !pushed(down) || !pushed(replica) {
+		t.Fatalf("expected the loaded value to be pushed to the replicas")
+	}
+
+	if err := xm.Set("replicated", []byte("2")); err != nil {
+		t.Fatal(err)
+	}
+	if string(down.values["replicated"]) != "2" || string(replica.values["replicated"]) != "2" {
+		t.Fatalf("expected Set to store the value on every owner")
+	}
+	if len(down.removed) != 0 || len(replica.removed) != 0 {
+		t.Fatalf("owners should not be invalidated, got %v and %v", down.removed, replica.removed)
+	}
+}
+
+func TestHTTPPoolSetRemove(t *testing.T) {
+	xm := NewGroup("http-set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	if err := getter.Set(context.Background(), &pb.SetRequest{Group: "http-set", Key: "k", Value: []byte("v")}); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := xm.Get("k"); err != nil || view.String() != "v" {
+		t.Fatalf("PUT should store the value")
+	}
+	if err := getter.Remove(context.Background(), &pb.Request{Group: "http-set", Key: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xm.Get("k"); err == nil {
+		t.Fatalf("DELETE should remove the value")
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	owner := &fakePeer{values: map[string][]byte{"remote": []byte("1")}}
+	xm := NewGroup("hot", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	xm.RegisterPeers(fakePeers{owner})
+
+	for i := 0; i < 200 && xm.CacheStats(HotCache).Items == 0; i++ {
+		if view, err := xm.Get("remote"); err != nil || view.String() != "1" {
+			t.Fatalf("failed to get remote from its owner")
+		}
+	}
+	if xm.CacheStats(HotCache).Items != 1 || xm.CacheStats(MainCache).Items != 0 {
+		t.Fatalf("remote should be mirrored in the hot cache only")
+	}
+
+	delete(owner.values, "remote")
+	if view, err := xm.Get("remote"); err != nil || view.String() != "1" {
+		t.Fatalf("hot key should be served without the owner")
+	}
+	if hits := xm.CacheStats(HotCache).Hits; hits != 1 {
+		t.Fatalf("expected 1 hot cache hit but got %d", hits)
+	}
+
+	if err := xm.Remove("remote"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xm.Get("remote"); err == nil {
+		t.Fatalf("Remove should drop the hot copy")
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	policies := map[string]PolicyFunc{"lru": LRU, "lfu": LFU, "arc": ARC, "tinylfu": TinyLFU}
+	for name, policy := range policies {
+		loads := 0
+		xm := NewGroup("policy-"+name, 64, GetterFunc(
+			func(key string) ([]byte, error) {
+				loads++
+				return []byte("value"), nil
+			}), WithPolicy(policy))
+
+		for i := 0; i < 3; i++ {
+			if _, err := xm.Get("hot"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := 0; i < 20; i++ {
+			xm.Get(fmt.Sprintf("key%d", i))
+		}
+		if stats := xm.CacheStats(MainCache); stats.Bytes > 64 || stats.Evictions == 0 {
+			t.Fatalf("%s: expected evictions within 64 bytes, got %+v", name, stats)
+		}
+		if loads != 21 {
+			t.Fatalf("%s: cache hot miss, loads = %d", name, loads)
+		}
+	}
+}
+
+func TestWithPolicyMemoryManager(t *testing.T) {
+	policies := map[string]PolicyFunc{"lru": LRU, "lfu": LFU, "arc": ARC, "tinylfu": TinyLFU}
+	for name, policy := range policies {
+		// the reloads of hot keys after a scan, which the managed
+		// group is expected to keep as well as a bounded one
+		reloads := func(opts ...GroupOption) (loads int) {
+			xm := NewGroup("policy-managed-"+name, 2<<10, GetterFunc(
+				func(key string) ([]byte, error) {
+					loads++
+					return []byte("value"), nil
+				}), append(opts, WithPolicy(policy))...)
+			for i := 0; i < 3; i++ {
+				for j := 0; j < 20; j++ {
+					xm.Get(fmt.Sprintf("hot%d", j))
+				}
+			}
+			for i := 0; i < 2000; i++ {
+				xm.Get(fmt.Sprintf("scan%d", i))
+			}
+			loads = 0
+			for j := 0; j < 20; j++ {
+				xm.Get(fmt.Sprintf("hot%d", j))
+			}
+			return loads
+		}
+		bounded := reloads()
+		managed := reloads(WithMemoryManager(NewMemoryManager(2<<10), Share{}))
+		if managed != bounded {
+			t.Fatalf("%s: expected the managed group to reload %d hot keys like a bounded one, got %d", name, bounded, managed)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	owner := &fakePeer{values: map[string][]byte{"remote": []byte("1")}}
+	xm := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if key == "missing" {
+				return nil, fmt.Errorf("%s not exist", key)
+			}
+			return []byte(key), nil
+		}))
+	xm.RegisterPeers(fakePeers{owner})
+
+	xm.Get("local")
+	xm.Get("local")
+	xm.Get("missing")
+	// falls back to the local Getter
+	xm.Get("remote-missing")
+
+	stats := xm.Stats()
+	expect := Stats{
+		Gets: 4, CacheHits: 1, PeerErrors: 1, Loads: 3, LoadsDeduped: 3,
+		LocalLoads: 2, LocalLoadErrs: 1, Bytes: 2 * int64(len("local")+len("remote-missing")), Items: 2,
+	}
+	expect.MainCache = stats.MainCache
+	expect.HotCache = stats.HotCache
+	if !reflect.DeepEqual(stats, expect) {
+		t.Fatalf("expected %+v but got %+v", expect, stats)
+	}
+	if stats.MainCache.Items != 2 || stats.MainCache.Hits != 1 {
+		t.Fatalf("unexpected main cache stats %+v", stats.MainCache)
+	}
+
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+	res, err := http.Get(srv.URL + defaultBasePath + statsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var all map[string]Stats
+	if err := json.NewDecoder(res.Body).Decode(&all); err != nil {
+		t.Fatal(err)
+	}
+	if all["stats"].Gets != 4 || all["stats"].MainCache.Items != 2 {
+		t.Fatalf("unexpected served stats %+v", all["stats"])
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	var loads int32
+	release := make(chan struct{})
+	xm := NewGroup("context", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			select {
+			case <-release:
+				return []byte(key), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}), WithLoadTimeout(time.Second))
+
+	done := make(chan error)
+	go func() {
+		view, err := xm.Get("slow")
+		if err == nil && view.String() != "slow" {
+			err = fmt.Errorf("unexpected value %s", view)
+		}
+		done <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := xm.GetContext(ctx, "slow"); err != context.DeadlineExceeded {
+		t.Fatalf("expected the caller to give up, got %v", err)
+	}
+
+	// the shared load goes on for the other caller
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Fatalf("expected a single load but got %d", n)
+	}
+}
+
+func TestLoadTimeout(t *testing.T) {
+	xm := NewGroup("load-timeout", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), WithLoadTimeout(10*time.Millisecond))
+
+	if _, err := xm.Get("hung"); err != context.DeadlineExceeded {
+		t.Fatalf("expected the load to time out, got %v", err)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	var loads int32
+	xm := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			atomic.AddInt32(&loads, 1)
+			return nil, ErrNotFound
+		}), WithNegativeCache(20*time.Millisecond, 1<<10))
+
+	for i := 0; i < 3; i++ {
+		if _, err := xm.Get("missing"); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads != 1 || xm.Stats().NegativeHits != 2 {
+		t.Fatalf("expected the missing key to be remembered, got %d loads", loads)
+	}
+	if s := xm.Stats(); s.Bytes != 0 || s.NegativeCache.Items != 1 {
+		t.Fatalf("expected the missing key apart from the budget, got %+v", s)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := xm.Get("missing"); err != ErrNotFound || loads != 2 {
+		t.Fatalf("expected the missing key to be forgotten after the TTL")
+	}
+	if err := xm.Set("missing", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := xm.Get("missing"); err != nil || view.String() != "v" {
+		t.Fatalf("expected Set to replace the missing key")
+	}
+}
+
+func TestNegativeCacheBound(t *testing.T) {
+	xm := NewGroup("negative-bound", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, ErrNotFound
+		}), WithNegativeCache(time.Hour, 0))
+	for i := 0; i < 100000; i++ {
+		xm.Get("missing-" + strconv.Itoa(i))
+	}
+	if b := xm.CacheStats(NegativeCache).Bytes; b > defaultNegativeBytes {
+		t.Fatalf("expected the negative cache to hold at most %d bytes, got %d", defaultNegativeBytes, b)
+	}
+}
+
+func TestHTTPPoolNotFound(t *testing.T) {
+	NewGroup("http-negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("loading %s: %w", key, ErrNotFound)
+		}))
+	srv := httptest.NewServer(NewHTTPPool("self"))
+	defer srv.Close()
+
+	getter := &httpGetter{baseURL: srv.URL + defaultBasePath}
+	err := getter.Get(context.Background(), &pb.Request{Group: "http-negative", Key: "k"}, &pb.Response{})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the peer to answer ErrNotFound, got %v", err)
+	}
+}
+
+// waitFor polls cond for up to a second.
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 1000; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return false
+}
+
+func TestRefreshAhead(t *testing.T) {
+	var loads int32
+	xm := NewGroup("refresh-ahead", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(strconv.Itoa(int(atomic.AddInt32(&loads, 1)))), nil
+		}), WithTTL(100*time.Millisecond), WithRefreshAhead(50*time.Millisecond))
+
+	xm.Get("k")
+	if view, _ := xm.Get("k"); view.String() != "1" || atomic.LoadInt32(&loads) != 1 {
+		t.Fatalf("expected a fresh value not to be refreshed")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if view, _ := xm.Get("k"); view.String() != "1" {
+		t.Fatalf("expected the current value while refreshing, got %s", view)
+	}
+	if !waitFor(func() bool { view, _ := xm.Get("k"); return view.String() == "2" }) {
+		view, _ := xm.Get("k")
+		t.Fatalf("expected the value to be refreshed in the background, got %s after %d loads", view, atomic.LoadInt32(&loads))
+	}
+	if xm.Stats().Refreshes == 0 {
+		t.Fatalf("expected the refresh to be counted")
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var loads int32
+	var fail atomic.Value
+	fail.Store(false)
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		if fail.Load().(bool) {
+			return nil, fmt.Errorf("%s unavailable", key)
+		}
+		return []byte(strconv.Itoa(int(atomic.AddInt32(&loads, 1)))), nil
+	})
+	xm := NewGroup("stale", 2<<10, getter, WithTTL(10*time.Millisecond),
+		WithStaleWhileRevalidate(time.Hour, ServeStaleOnError))
+
+	xm.Get("k")
+	time.Sleep(20 * time.Millisecond)
+	if view, err := xm.Get("k"); err != nil || view.String() != "1" {
+		t.Fatalf("expected the stale value, got %s, %v", view, err)
+	}
+	if !waitFor(func() bool { view, _ := xm.Get("k"); return view.String() == "2" }) {
+		t.Fatalf("expected the stale value to be reloaded")
+	}
+
+	fail.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if view, err := xm.Get("k"); err != nil || view.String() != "2" {
+			t.Fatalf("expected the stale value despite the loader error, got %s, %v", view, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	xm = NewGroup("stale-drop", 2<<10, getter, WithTTL(10*time.Millisecond),
+		WithStaleWhileRevalidate(time.Hour, DropStaleOnError))
+	fail.Store(false)
+	xm.Get("k")
+	fail.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := xm.Get("k"); err != nil {
+		t.Fatalf("expected the stale value, got %v", err)
+	}
+	if !waitFor(func() bool { _, err := xm.Get("k"); return err != nil }) {
+		t.Fatalf("expected the stale value to be dropped after the loader error")
+	}
+}
+
+func TestDropStaleKeepsNewValue(t *testing.T) {
+	started, release := make(chan bool, 1), make(chan bool)
+	var loads int32
+	xm := NewGroup("stale-set", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if atomic.AddInt32(&loads, 1) == 1 {
+				return []byte("1"), nil
+			}
+			started <- true
+			<-release
+			return nil, fmt.Errorf("%s unavailable", key)
+		}), WithTTL(10*time.Millisecond), WithStaleWhileRevalidate(time.Hour, DropStaleOnError))
+
+	xm.Get("k")
+	time.Sleep(20 * time.Millisecond)
+	xm.Get("k")
+	<-started
+	if err := xm.Set("k", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	waitFor(func() bool { _, ok := xm.refreshing.Load("k"); return !ok })
+	if view, ok := xm.mainCache.get("k"); !ok || view.String() != "new" {
+		t.Fatalf("expected the failed reload to keep the value set meanwhile, got %q", view)
+	}
+}